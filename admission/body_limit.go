@@ -0,0 +1,30 @@
+package admission
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// LimitBody rejects requests with a body larger than maxBytes with a 413. A request
+// which declares its Content-Length is rejected before it reaches next, otherwise
+// reading beyond maxBytes fails with an error for which IsTooLarge is true.
+func LimitBody(next http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			w.Header().Set("Connection", "close")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			fmt.Fprintf(w, "request body is larger than %d bytes\n", maxBytes)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsTooLarge returns true when err was caused by a body larger than the limit of LimitBody
+func IsTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
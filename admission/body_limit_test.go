@@ -0,0 +1,60 @@
+package admission
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func readingHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if IsTooLarge(err) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.Write(body)
+}
+
+func Test_LimitBody_RejectsContentLength(t *testing.T) {
+	called := false
+	handler := LimitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}), 4)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too large")))
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status want: %d, got: %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	if called {
+		t.Errorf("want the function not to be called")
+	}
+}
+
+func Test_LimitBody_FailsChunkedBodyWhenRead(t *testing.T) {
+	handler := LimitBody(http.HandlerFunc(readingHandler), 4)
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too large"))
+	r.ContentLength = -1
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status want: %d, got: %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func Test_LimitBody_PassesBodyWithinLimit(t *testing.T) {
+	handler := LimitBody(http.HandlerFunc(readingHandler), 4)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("four")))
+
+	if w.Code != http.StatusOK || w.Body.String() != "four" {
+		t.Errorf("want 200 with the body, got: %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,134 @@
+package admission
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/metrics"
+)
+
+// WaitQueue limits the requests in flight like the concurrency limiter, but requests
+// above the limit wait in FIFO order for a free slot instead of being rejected.
+// A 429 is returned when MaxDepth requests are already waiting, and a 503 when
+// a request has waited for MaxWait.
+type WaitQueue struct {
+	Handler     http.Handler
+	MaxInflight int
+	MaxDepth    int
+	MaxWait     time.Duration
+	Metrics     *metrics.Admission // Metrics records queue depth and wait time, optional
+
+	mutex    sync.Mutex
+	inflight int
+	waiters  *list.List // waiters holds a chan struct{} for each waiting request, closed when it is admitted
+}
+
+// NewWaitQueue creates a handler which queues requests above maxInflight
+func NewWaitQueue(handler http.Handler, maxInflight int, maxDepth int, maxWait time.Duration) *WaitQueue {
+	return &WaitQueue{
+		Handler:     handler,
+		MaxInflight: maxInflight,
+		MaxDepth:    maxDepth,
+		MaxWait:     maxWait,
+		waiters:     list.New(),
+	}
+}
+
+func (q *WaitQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if status, err := q.acquire(r); err != nil {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "%s\n", err.Error())
+		return
+	}
+	defer q.release()
+
+	q.Handler.ServeHTTP(w, r)
+}
+
+// acquire takes a slot, waiting for one when MaxInflight requests are in flight
+func (q *WaitQueue) acquire(r *http.Request) (int, error) {
+	q.mutex.Lock()
+	if q.inflight < q.MaxInflight && q.waiters.Len() == 0 {
+		q.inflight++
+		q.mutex.Unlock()
+		return 0, nil
+	}
+
+	if q.waiters.Len() >= q.MaxDepth {
+		q.mutex.Unlock()
+		return http.StatusTooManyRequests, fmt.Errorf("concurrent request limit exceeded and wait queue is full. Max queue depth: %d", q.MaxDepth)
+	}
+
+	admitted := make(chan struct{})
+	element := q.waiters.PushBack(admitted)
+	q.setDepth()
+	q.mutex.Unlock()
+
+	start := time.Now()
+	defer q.observeWait(start)
+
+	timer := time.NewTimer(q.MaxWait)
+	defer timer.Stop()
+
+	select {
+	case <-admitted:
+		return 0, nil
+	case <-timer.C:
+		if q.leave(element, admitted) {
+			return 0, nil
+		}
+		return http.StatusServiceUnavailable, fmt.Errorf("timed out after %s waiting for a concurrent request slot", q.MaxWait)
+	case <-r.Context().Done():
+		if q.leave(element, admitted) {
+			return 0, nil
+		}
+		return http.StatusServiceUnavailable, r.Context().Err()
+	}
+}
+
+// leave removes a waiting request from the queue, and returns true if it was admitted meanwhile
+func (q *WaitQueue) leave(element *list.Element, admitted chan struct{}) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	select {
+	case <-admitted:
+		return true
+	default:
+	}
+
+	q.waiters.Remove(element)
+	q.setDepth()
+	return false
+}
+
+// release hands the slot over to the first waiting request, or frees it
+func (q *WaitQueue) release() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if front := q.waiters.Front(); front != nil {
+		q.waiters.Remove(front)
+		q.setDepth()
+		close(front.Value.(chan struct{}))
+		return
+	}
+
+	q.inflight--
+}
+
+// setDepth records the number of waiting requests, q.mutex must be held
+func (q *WaitQueue) setDepth() {
+	if q.Metrics != nil {
+		q.Metrics.QueueDepth.Set(float64(q.waiters.Len()))
+	}
+}
+
+func (q *WaitQueue) observeWait(start time.Time) {
+	if q.Metrics != nil {
+		q.Metrics.QueueWaitSeconds.Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,96 @@
+package admission
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingHandler holds each request until release is closed, and reports its arrival on started
+func blockingHandler(started chan<- int, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- len(r.URL.Query().Get("id"))
+		<-release
+	})
+}
+
+func serve(q http.Handler, id string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	q.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?id="+id, nil))
+	return w
+}
+
+func waitForDepth(t *testing.T, q *WaitQueue, depth int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		q.mutex.Lock()
+		n := q.waiters.Len()
+		q.mutex.Unlock()
+		if n == depth {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("want %d waiting requests", depth)
+}
+
+func TestWaitQueue_QueuedRequestsAreAdmittedInOrder(t *testing.T) {
+	started := make(chan int, 3)
+	release := make(chan struct{})
+	q := NewWaitQueue(blockingHandler(started, release), 1, 2, time.Second)
+
+	wg := sync.WaitGroup{}
+	wg.Add(3)
+	go func() { defer wg.Done(); serve(q, "a") }()
+	<-started
+
+	go func() { defer wg.Done(); serve(q, "bb") }()
+	waitForDepth(t, q, 1)
+	go func() { defer wg.Done(); serve(q, "ccc") }()
+	waitForDepth(t, q, 2)
+
+	close(release)
+	wg.Wait()
+
+	for _, want := range []int{2, 3} {
+		if got := <-started; got != want {
+			t.Errorf("want request %d to be admitted next, got: %d", want, got)
+		}
+	}
+}
+
+func TestWaitQueue_FullQueueIsRejected(t *testing.T) {
+	started := make(chan int, 2)
+	release := make(chan struct{})
+	defer close(release)
+
+	q := NewWaitQueue(blockingHandler(started, release), 1, 1, time.Second)
+
+	go serve(q, "a")
+	<-started
+	go serve(q, "b")
+	waitForDepth(t, q, 1)
+
+	if w := serve(q, "c"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("want status %d, got: %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+func TestWaitQueue_WaitExpires(t *testing.T) {
+	started := make(chan int, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	q := NewWaitQueue(blockingHandler(started, release), 1, 1, time.Millisecond*50)
+
+	go serve(q, "a")
+	<-started
+
+	if w := serve(q, "b"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("want status %d, got: %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	waitForDepth(t, q, 0)
+}
@@ -0,0 +1,183 @@
+package async
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/admission"
+	"github.com/paulofelipefeitosa/of-watchdog/logging"
+	"github.com/paulofelipefeitosa/of-watchdog/tracing"
+)
+
+// PathPrefix routes a call to the queue, i.e. /async-function/orders is run as /orders
+const PathPrefix = "/async-function"
+
+// defaultCallbackTimeout bounds the POST of a result to its callback URL
+const defaultCallbackTimeout = 10 * time.Second
+
+// IsAsync returns true when the call asks to be run in the background
+func IsAsync(r *http.Request) bool {
+	return r.URL.Path == PathPrefix ||
+		strings.HasPrefix(r.URL.Path, PathPrefix+"/") ||
+		strings.EqualFold(r.Header.Get("X-Async"), "true")
+}
+
+// Queue accepts calls with 202 Accepted and runs them through Handler in the background,
+// then POSTs each result to the X-Callback-Url given with the call.
+type Queue struct {
+	Handler http.Handler  // Handler runs the function, i.e. the handler of the operational mode
+	Workers int           // Workers is the number of calls run at the same time
+	Size    int           // Size is the number of calls which can wait for a worker, beyond which 429 is returned
+	Timeout time.Duration // Timeout of a background call, 0 for no limit
+	Client  *http.Client  // Client POSTs results to callback URLs, optional
+
+	calls chan *call
+}
+
+type call struct {
+	id          string
+	callbackURL string
+	request     *http.Request
+	body        []byte
+}
+
+// Start starts the workers
+func (q *Queue) Start() {
+	if q.Client == nil {
+		q.Client = &http.Client{Timeout: defaultCallbackTimeout}
+	}
+
+	q.calls = make(chan *call, q.Size)
+
+	for i := 0; i < q.Workers; i++ {
+		go q.work()
+	}
+}
+
+// ServeHTTP queues the call and returns its X-Call-Id
+func (q *Queue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if admission.IsTooLarge(err) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf("unable to read request body: %s", err.Error()), status)
+		return
+	}
+
+	id := r.Header.Get(logging.CallIDHeader)
+	if len(id) == 0 {
+		id = logging.NewCallID()
+	}
+
+	// The call outlives the request, only its call ID and trace are kept
+	ctx := tracing.WithSpan(logging.WithCallID(context.Background(), id), tracing.FromContext(r.Context()))
+	request := r.Clone(ctx)
+	request.URL.Path = strings.TrimPrefix(request.URL.Path, PathPrefix)
+	if len(request.URL.Path) == 0 {
+		request.URL.Path = "/"
+	}
+	request.RequestURI = request.URL.RequestURI()
+	request.Header.Del("X-Async")
+	request.Header.Set(logging.CallIDHeader, id)
+
+	c := &call{
+		id:          id,
+		callbackURL: r.Header.Get("X-Callback-Url"),
+		request:     request,
+		body:        body,
+	}
+
+	select {
+	case q.calls <- c:
+		w.Header().Set(logging.CallIDHeader, id)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "async queue is full", http.StatusTooManyRequests)
+	}
+}
+
+func (q *Queue) work() {
+	for c := range q.calls {
+		q.run(c)
+	}
+}
+
+func (q *Queue) run(c *call) {
+	start := time.Now()
+
+	ctx := c.request.Context()
+	cancel := func() {}
+	if q.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, q.Timeout)
+	}
+	defer cancel()
+
+	request := c.request.WithContext(ctx)
+	request.Body = ioutil.NopCloser(bytes.NewReader(c.body))
+	request.ContentLength = int64(len(c.body))
+
+	response := newRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Handler.ServeHTTP(response, request)
+	}()
+
+	var result *recorder
+	select {
+	case <-done:
+		result = response
+	case <-ctx.Done():
+		// The result is sent straight away, the runner finishes on its own exec_timeout
+		result = newRecorder()
+		result.WriteHeader(http.StatusGatewayTimeout)
+		result.Write([]byte(fmt.Sprintf("async call timed out after %s", q.Timeout)))
+	}
+
+	duration := time.Since(start)
+	logger := logging.FromContext(ctx)
+	logger.Info(fmt.Sprintf("Async call %s %s - %d - took %f secs", c.id, c.request.RequestURI, result.status, duration.Seconds()))
+
+	if len(c.callbackURL) > 0 {
+		if err := q.callback(c, result, duration); err != nil {
+			logger.Error(fmt.Sprintf("Async call %s callback to %s failed: %s", c.id, c.callbackURL, err.Error()))
+		}
+	}
+
+	// The worker is only freed once the handler returns, so that no more than Workers calls run at once
+	<-done
+}
+
+// callback POSTs the result of the call, its status is given as X-Function-Status
+func (q *Queue) callback(c *call, result *recorder, duration time.Duration) error {
+	req, err := http.NewRequest(http.MethodPost, c.callbackURL, bytes.NewReader(result.body.Bytes()))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range result.header {
+		req.Header[k] = v
+	}
+	req.Header.Set(logging.CallIDHeader, c.id)
+	req.Header.Set("X-Function-Status", strconv.Itoa(result.status))
+	req.Header.Set("X-Duration-Seconds", fmt.Sprintf("%f", duration.Seconds()))
+
+	res, err := q.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package async
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/tracing"
+)
+
+type callbackResult struct {
+	header http.Header
+	body   string
+}
+
+func makeCallbackServer() (*httptest.Server, chan callbackResult) {
+	results := make(chan callbackResult, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		results <- callbackResult{header: r.Header, body: string(body)}
+	}))
+	return srv, results
+}
+
+func TestIsAsync(t *testing.T) {
+	cases := []struct {
+		path   string
+		header string
+		want   bool
+	}{
+		{"/", "", false},
+		{"/async-functions", "", false},
+		{"/async-function", "", true},
+		{"/async-function/orders", "", true},
+		{"/", "true", true},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, c.path, nil)
+		if len(c.header) > 0 {
+			r.Header.Set("X-Async", c.header)
+		}
+
+		if got := IsAsync(r); got != c.want {
+			t.Errorf("%s X-Async: %q, want %t, got: %t", c.path, c.header, c.want, got)
+		}
+	}
+}
+
+func TestQueue_PostsResultToCallback(t *testing.T) {
+	callback, results := makeCallbackServer()
+	defer callback.Close()
+
+	q := &Queue{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(r.URL.Path + " " + string(body)))
+		}),
+		Workers: 1,
+		Size:    1,
+		Timeout: time.Second,
+	}
+	q.Start()
+
+	r := httptest.NewRequest(http.MethodPost, "/async-function/orders", strings.NewReader("hello"))
+	r.Header.Set("X-Callback-Url", callback.URL)
+	w := httptest.NewRecorder()
+
+	q.ServeHTTP(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status %d, got: %d", http.StatusAccepted, w.Code)
+	}
+
+	callID := w.Header().Get("X-Call-Id")
+	if len(callID) == 0 {
+		t.Fatalf("want X-Call-Id to be returned")
+	}
+
+	select {
+	case result := <-results:
+		if result.body != "/orders hello" {
+			t.Errorf("want body %q, got: %q", "/orders hello", result.body)
+		}
+		if got := result.header.Get("X-Function-Status"); got != "201" {
+			t.Errorf("want X-Function-Status 201, got: %q", got)
+		}
+		if got := result.header.Get("X-Call-Id"); got != callID {
+			t.Errorf("want X-Call-Id %q, got: %q", callID, got)
+		}
+		if got := result.header.Get("Content-Type"); got != "text/plain" {
+			t.Errorf("want Content-Type from the function, got: %q", got)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("callback was not called")
+	}
+}
+
+func TestQueue_TimeoutIsSentToCallback(t *testing.T) {
+	callback, results := makeCallbackServer()
+	defer callback.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	q := &Queue{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}),
+		Workers: 1,
+		Size:    1,
+		Timeout: time.Millisecond * 50,
+	}
+	q.Start()
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-Async", "true")
+	r.Header.Set("X-Callback-Url", callback.URL)
+	q.ServeHTTP(httptest.NewRecorder(), r)
+
+	select {
+	case result := <-results:
+		if got := result.header.Get("X-Function-Status"); got != "504" {
+			t.Errorf("want X-Function-Status 504, got: %q", got)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("callback was not called")
+	}
+}
+
+func TestQueue_TimedOutCallKeepsItsWorker(t *testing.T) {
+	callback, results := makeCallbackServer()
+	defer callback.Close()
+
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	q := &Queue{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started <- r.URL.Path
+			if r.URL.Path == "/slow" {
+				<-release
+			}
+		}),
+		Workers: 1,
+		Size:    1,
+		Timeout: time.Millisecond * 50,
+	}
+	q.Start()
+
+	for _, path := range []string{"/slow", "/next"} {
+		r := httptest.NewRequest(http.MethodPost, PathPrefix+path, nil)
+		r.Header.Set("X-Callback-Url", callback.URL)
+		q.ServeHTTP(httptest.NewRecorder(), r)
+
+		// The first call is taken by the worker before the next one is queued
+		if path == "/slow" {
+			<-started
+		}
+	}
+
+	select {
+	case <-results:
+	case <-time.After(time.Second * 2):
+		t.Fatalf("callback of the timed out call was not called")
+	}
+
+	select {
+	case path := <-started:
+		t.Fatalf("want %s to wait until the timed out call returns", path)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	close(release)
+	select {
+	case path := <-started:
+		if path != "/next" {
+			t.Errorf("want /next to run, got: %s", path)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("next call did not run once the worker was freed")
+	}
+}
+
+func TestQueue_KeepsTrace(t *testing.T) {
+	tracing.SetExporter(discardExporter{})
+	defer tracing.SetExporter(nil)
+
+	traces := make(chan string, 1)
+	q := &Queue{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traces <- tracing.FromContext(r.Context()).Traceparent()
+		}),
+		Workers: 1,
+		Size:    1,
+	}
+	q.Start()
+
+	ctx, span := tracing.StartSpan(context.Background(), "POST", tracing.KindServer)
+	r := httptest.NewRequest(http.MethodPost, PathPrefix, nil).WithContext(ctx)
+	q.ServeHTTP(httptest.NewRecorder(), r)
+	span.Finish()
+
+	select {
+	case traceparent := <-traces:
+		if traceparent != span.Traceparent() {
+			t.Errorf("want the call in the trace of the request %s, got: %q", span.Traceparent(), traceparent)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("call did not run")
+	}
+}
+
+// discardExporter enables tracing without sending the spans anywhere
+type discardExporter struct{}
+
+func (discardExporter) Export(*tracing.Span) {}
+
+func TestQueue_FullQueueIsRejected(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{}, 1)
+	q := &Queue{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			<-release
+		}),
+		Workers: 1,
+		Size:    1,
+	}
+	q.Start()
+
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		q.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/async-function", nil))
+		codes = append(codes, w.Code)
+
+		// The first call is taken by the worker before the queue fills up
+		if i == 0 {
+			<-started
+		}
+	}
+
+	want := []int{http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Errorf("call %d: want status %d, got: %d", i, want[i], codes[i])
+		}
+	}
+}
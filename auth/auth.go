@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// DefaultSignatureHeader carries the HMAC-SHA256 of the body, as sha256=<hex> or <hex>
+const DefaultSignatureHeader = "X-Hub-Signature"
+
+// MaxSignedBodyBytes is the largest body read into memory to check its signature,
+// larger requests are rejected with 413 even when max_request_bytes is not set
+const MaxSignedBodyBytes = 10 << 20
+
+// Authenticator only passes requests which present any of the configured credentials
+// to Handler: basic auth, one of the bearer tokens, or a valid HMAC signature of the body.
+// Other requests are rejected with 401.
+type Authenticator struct {
+	Handler         http.Handler
+	BasicUser       string
+	BasicPassword   string
+	BearerTokens    []string
+	HMACSecret      []byte
+	SignatureHeader string
+}
+
+// Enabled returns true when at least one kind of credential is configured
+func (a *Authenticator) Enabled() bool {
+	return len(a.BasicUser) > 0 || len(a.BearerTokens) > 0 || len(a.HMACSecret) > 0
+}
+
+func (a *Authenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.basicAuth(r) || a.bearerToken(r) {
+		a.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	if len(a.HMACSecret) > 0 && len(r.Header.Get(a.signatureHeader())) > 0 {
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxSignedBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		if a.validSignature(r.Header.Get(a.signatureHeader()), body) {
+			a.Handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	if len(a.BasicUser) > 0 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="of-watchdog"`)
+	} else if len(a.BearerTokens) > 0 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="of-watchdog"`)
+	}
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+func (a *Authenticator) basicAuth(r *http.Request) bool {
+	if len(a.BasicUser) == 0 {
+		return false
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	validUser := subtle.ConstantTimeCompare([]byte(user), []byte(a.BasicUser)) == 1
+	validPassword := subtle.ConstantTimeCompare([]byte(password), []byte(a.BasicPassword)) == 1
+	return validUser && validPassword
+}
+
+func (a *Authenticator) bearerToken(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return false
+	}
+
+	token := []byte(strings.TrimSpace(header[len("Bearer "):]))
+	valid := false
+	for _, bearerToken := range a.BearerTokens {
+		if subtle.ConstantTimeCompare(token, []byte(bearerToken)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// validSignature checks the HMAC-SHA256 of body against the signature header
+func (a *Authenticator) validSignature(signature string, body []byte) bool {
+	want, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(want, Sign(a.HMACSecret, body))
+}
+
+func (a *Authenticator) signatureHeader() string {
+	if len(a.SignatureHeader) == 0 {
+		return DefaultSignatureHeader
+	}
+	return a.SignatureHeader
+}
+
+// Sign returns the HMAC-SHA256 of body with secret
+func Sign(secret []byte, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// echo replies with the body it was given, to check it survives the signature check
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Write(body)
+})
+
+func serve(a *Authenticator, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	return w
+}
+
+func Test_Authenticator_BasicAuth(t *testing.T) {
+	a := &Authenticator{Handler: echo, BasicUser: "admin", BasicPassword: "secret"}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello"))
+	r.SetBasicAuth("admin", "secret")
+	if w := serve(a, r); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("want 200 with valid credentials, got: %d %q", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.SetBasicAuth("admin", "wrong")
+	w := serve(a, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("want 401 with a wrong password, got: %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic") {
+		t.Errorf("want a basic auth challenge, got: %q", w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func Test_Authenticator_BearerToken(t *testing.T) {
+	a := &Authenticator{Handler: echo, BearerTokens: []string{"first", "second"}}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer second")
+	if w := serve(a, r); w.Code != http.StatusOK {
+		t.Errorf("want 200 with a valid token, got: %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer third")
+	if w := serve(a, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("want 401 with an unknown token, got: %d", w.Code)
+	}
+
+	if w := serve(a, httptest.NewRequest(http.MethodGet, "/", nil)); w.Code != http.StatusUnauthorized {
+		t.Errorf("want 401 without a token, got: %d", w.Code)
+	}
+}
+
+func Test_Authenticator_HMACSignature(t *testing.T) {
+	secret := []byte("webhook-secret")
+	a := &Authenticator{Handler: echo, HMACSecret: secret, SignatureHeader: "X-Signature"}
+	signature := hex.EncodeToString(Sign(secret, []byte(`{"action":"opened"}`)))
+
+	cases := []struct {
+		name      string
+		signature string
+		body      string
+		want      int
+	}{
+		{"prefixed", "sha256=" + signature, `{"action":"opened"}`, http.StatusOK},
+		{"bare hex", signature, `{"action":"opened"}`, http.StatusOK},
+		{"tampered body", "sha256=" + signature, `{"action":"closed"}`, http.StatusUnauthorized},
+		{"not hex", "sha256=xyz", `{"action":"opened"}`, http.StatusUnauthorized},
+		{"unsigned", "", `{"action":"opened"}`, http.StatusUnauthorized},
+	}
+
+	for _, testCase := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testCase.body))
+		if len(testCase.signature) > 0 {
+			r.Header.Set("X-Signature", testCase.signature)
+		}
+
+		w := serve(a, r)
+		if w.Code != testCase.want {
+			t.Errorf("(%s) status want: %d, got: %d", testCase.name, testCase.want, w.Code)
+		}
+		if testCase.want == http.StatusOK && w.Body.String() != testCase.body {
+			t.Errorf("(%s) want the body passed on, got: %q", testCase.name, w.Body.String())
+		}
+	}
+}
+
+func Test_Authenticator_HMACSignatureLimitsBody(t *testing.T) {
+	secret := []byte("webhook-secret")
+	a := &Authenticator{Handler: echo, HMACSecret: secret}
+	body := strings.Repeat("a", MaxSignedBodyBytes+1)
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set(DefaultSignatureHeader, "sha256="+hex.EncodeToString(Sign(secret, []byte(body))))
+	if w := serve(a, r); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("want 413 for a signed body over the limit, got: %d", w.Code)
+	}
+}
+
+func Test_ReadTokens(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tokens")
+	ioutil.WriteFile(path, []byte("first\n\n  second \n"), 0600)
+
+	tokens, err := ReadTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("want: %v, got: %v", want, tokens)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	ioutil.WriteFile(empty, []byte("\n"), 0600)
+	if _, err := ReadSecret(empty); err == nil {
+		t.Errorf("want an error for an empty secret")
+	}
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// ReadSecret reads a secret from a file, such as a mounted Kubernetes secret,
+// without the trailing newline which editors and kubectl tend to add
+func ReadSecret(path string) (string, error) {
+	secret, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret: %s", err.Error())
+	}
+
+	value := strings.TrimSpace(string(secret))
+	if len(value) == 0 {
+		return "", fmt.Errorf("secret %s is empty", path)
+	}
+	return value, nil
+}
+
+// ReadTokens reads one bearer token per line, blank lines are skipped
+func ReadTokens(path string) ([]string, error) {
+	secret, err := ReadSecret(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []string
+	for _, line := range strings.Split(secret, "\n") {
+		if token := strings.TrimSpace(line); len(token) > 0 {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
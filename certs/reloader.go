@@ -0,0 +1,149 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader serves a certificate and key pair from files, and loads them again when
+// they change on disk, so that a rotated secret is used without a restart.
+type Reloader struct {
+	CertFile string
+	KeyFile  string
+
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	modified    time.Time // modified is the latest modification time of the two files when they were loaded
+}
+
+// NewReloader loads the certificate and key pair, which must be valid to start
+func NewReloader(certFile string, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for use as tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.certificate, nil
+}
+
+// Reload loads the pair again when either file was modified since it was last loaded,
+// and returns true when it did. The current certificate is kept when the pair is invalid,
+// i.e. while only one of the files has been replaced.
+func (r *Reloader) Reload() (bool, error) {
+	modified, err := latestModification(r.CertFile, r.KeyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mutex.RLock()
+	unchanged := r.certificate != nil && !modified.After(r.modified)
+	r.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("unable to load certificate %s and key %s: %s", r.CertFile, r.KeyFile, err.Error())
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.certificate = &certificate
+	r.modified = modified
+	return true, nil
+}
+
+// Watch checks the files for changes every interval until stop is closed
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				log.Printf("Keeping the current TLS certificate: %s\n", err.Error())
+			} else if reloaded {
+				log.Printf("Reloaded TLS certificate from %s\n", r.CertFile)
+			}
+		}
+	}
+}
+
+// latestModification follows symlinks, as a mounted Kubernetes secret is updated by swapping a link
+func latestModification(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// NewConfig returns a server TLS config which serves the certificate of the reloader,
+// and when clientCAFile is set, verifies client certificates signed by one of its CAs.
+// A client may still connect without a certificate, so that health checks do not need
+// one, wrap the function handler with RequireClientCert to reject those requests.
+func NewConfig(reloader *Reloader, clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if len(clientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client CA: %s", err.Error())
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", clientCAFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+// RequireClientCert rejects requests which were not made with a client certificate
+// verified against the client CAs of the TLS config
+func RequireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
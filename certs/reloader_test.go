@@ -0,0 +1,184 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair writes a self-signed certificate for commonName and its key, and returns the certificate
+func writePair(t *testing.T, certFile string, keyFile string, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	certificate, _ := x509.ParseCertificate(der)
+	return certificate
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func commonName(t *testing.T, r *Reloader) string {
+	certificate, _ := r.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func Test_Reloader_ReloadsChangedFiles(t *testing.T) {
+	dir := tempDir(t)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writePair(t, certFile, keyFile, "first")
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded, _ := r.Reload(); reloaded {
+		t.Errorf("want no reload of unchanged files")
+	}
+
+	writePair(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+
+	reloaded, err := r.Reload()
+	if err != nil || !reloaded {
+		t.Fatalf("want a reload of the rotated files, got: %v %v", reloaded, err)
+	}
+	if got := commonName(t, r); got != "second" {
+		t.Errorf("want the rotated certificate, got: %s", got)
+	}
+}
+
+func Test_Reloader_KeepsCertificateWhenInvalid(t *testing.T) {
+	dir := tempDir(t)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writePair(t, certFile, keyFile, "first")
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the certificate has been replaced so far
+	writePair(t, certFile, filepath.Join(dir, "other.key"), "second")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+
+	if _, err := r.Reload(); err == nil {
+		t.Errorf("want an error for a mismatched pair")
+	}
+	if got := commonName(t, r); got != "first" {
+		t.Errorf("want the current certificate kept, got: %s", got)
+	}
+}
+
+func Test_NewReloader_RequiresValidPair(t *testing.T) {
+	dir := tempDir(t)
+	if _, err := NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")); err == nil {
+		t.Errorf("want an error for missing files")
+	}
+}
+
+func Test_RequireClientCert_RejectsCallsWithoutCertificate(t *testing.T) {
+	dir := tempDir(t)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	serverCert := writePair(t, certFile, keyFile, "server")
+
+	caFile, caKeyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	writePair(t, caFile, caKeyFile, "client")
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := NewConfig(r, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(RequireClientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCert)
+
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}}}
+	res, err := anonymous.Get(server.URL)
+	if err != nil {
+		t.Fatalf("want the handshake to succeed without a client certificate: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("want %d without a client certificate, got %d", http.StatusUnauthorized, res.StatusCode)
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(caFile, caKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		ServerName:   "localhost",
+		Certificates: []tls.Certificate{clientCert},
+	}}}
+
+	res, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("want a request with a client certificate to succeed: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want %d with a client certificate, got %d", http.StatusOK, res.StatusCode)
+	}
+}
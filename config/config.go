@@ -27,6 +27,28 @@ type WatchdogConfig struct {
 	// which some servers do not support.
 	BufferHTTPBody bool
 
+	// BufferHTTPResponse buffers the upstream response in memory
+	// so that the client is sent a Content-Length, otherwise the
+	// response is streamed.
+	BufferHTTPResponse bool
+
+	// HTTPFlushInterval is the maximum time a streamed response is
+	// held before it is flushed to the client, negative to flush
+	// after each write.
+	HTTPFlushInterval time.Duration
+
+	// UpgradeIdleTimeout closes an upgraded connection, such as a WebSocket,
+	// once it has been idle for this long, otherwise ExecTimeout applies.
+	UpgradeIdleTimeout time.Duration
+
+	// H2C accepts HTTP/2 without TLS on the watchdog's port
+	// alongside HTTP/1.1, i.e. for gRPC clients.
+	H2C bool
+
+	// UpstreamH2C speaks HTTP/2 with prior knowledge to the
+	// upstream in http mode, i.e. for gRPC functions.
+	UpstreamH2C bool
+
 	// MetricsPort TCP port on which to serve HTTP Prometheus metrics
 	MetricsPort int
 
@@ -36,8 +58,199 @@ type WatchdogConfig struct {
 	// have an immediate response of 429.
 	MaxInflight int
 
+	// InflightQueueDepth lets requests above MaxInflight wait in
+	// a FIFO queue of this depth instead of getting a 429.
+	InflightQueueDepth int
+
+	// InflightQueueWait is the maximum time a request waits in
+	// the queue before getting a 503.
+	InflightQueueWait time.Duration
+
 	CRIUExec       bool
 	RestoreLogPath string
+
+	// CRIUCheckpoint lets the watchdog checkpoint the function in
+	// http mode once it is warm, and restore it from CRIUImagesDir
+	// on later boots instead of cold-starting.
+	CRIUCheckpoint bool
+
+	// CRIUImagesDir is the directory for checkpoint images
+	CRIUImagesDir string
+
+	// CRIUBinary is the criu executable to invoke
+	CRIUBinary string
+
+	// CRIUWarmupTimeout is the maximum time to wait for the upstream
+	// to respond before giving up on the checkpoint
+	CRIUWarmupTimeout time.Duration
+
+	// ReadinessProbe is one of tcp, http or exec. When set in http mode
+	// the lock-file is only written once the upstream passes the probe.
+	ReadinessProbe string
+
+	// ReadinessPath is the path requested by the http readiness probe
+	ReadinessPath string
+
+	// ReadinessCommand is run by the exec readiness probe
+	ReadinessCommand string
+
+	// ReadinessInterval is the time between two readiness probes
+	ReadinessInterval time.Duration
+
+	// ReadinessTimeout is the timeout of a single readiness probe
+	ReadinessTimeout time.Duration
+
+	// ReadinessMaxWait is the maximum time to wait for the upstream to be ready
+	ReadinessMaxWait time.Duration
+
+	// RestartPolicy is one of never, on-failure or always and applies
+	// to the long-running function process in http and afterburn modes
+	RestartPolicy string
+
+	// RestartBackoff is the wait before the first restart, doubled
+	// for each consecutive restart up to RestartMaxBackoff
+	RestartBackoff time.Duration
+
+	// RestartMaxBackoff caps the wait between restarts
+	RestartMaxBackoff time.Duration
+
+	// MaxRestarts in a row before the watchdog exits, 0 for no limit
+	MaxRestarts int
+
+	// AfterBurnWorkers is the number of afterburn processes which
+	// serve requests concurrently
+	AfterBurnWorkers int
+
+	// PreforkPoolSize is the number of processes kept started and
+	// blocked on stdin in streaming and serializing modes, 0 to fork
+	// on each request
+	PreforkPoolSize int
+
+	// CGIResponse lets the function print a CGI header block with
+	// Status, Content-Type and other headers before the body in
+	// serializing mode
+	CGIResponse bool
+
+	// ExitCodeStatus maps non-zero exit codes of the function to a
+	// HTTP status in serializing mode, i.e. "1:500,2:400"
+	ExitCodeStatus map[int]int
+
+	// IncludeStderr writes the stderr of a failed function to the
+	// response body in serializing mode
+	IncludeStderr bool
+
+	// AsyncWorkers enables asynchronous calls via /async-function/ or
+	// X-Async: true, and is the number of calls run at the same time.
+	AsyncWorkers int
+
+	// AsyncQueueSize is the number of asynchronous calls which can
+	// wait for a worker before new calls are rejected with 429.
+	AsyncQueueSize int
+
+	// AsyncTimeout is the maximum duration of an asynchronous call.
+	AsyncTimeout time.Duration
+
+	// ResourceSampleInterval is how often the resource usage of a
+	// long-running function process is read from /proc, 0 to disable.
+	ResourceSampleInterval time.Duration
+
+	// OTLPEndpoint enables tracing, spans are exported with OTLP/HTTP
+	// to this collector, i.e. http://collector:4318
+	OTLPEndpoint string
+
+	// OTelServiceName is the service.name of the exported spans
+	OTelServiceName string
+
+	// LogFormat is text for the classic log lines, or json
+	LogFormat string
+
+	// LogLevel is the minimum level logged: debug, info, warn or error
+	LogLevel string
+
+	// AccessLog is the format of the access log: common, combined or json,
+	// or empty to disable it
+	AccessLog string
+
+	// MaxRequestBytes is the largest request body accepted, larger
+	// bodies are rejected with 413. 0 for no limit.
+	MaxRequestBytes int64
+
+	// DropRequestHeaders are never passed to the function
+	DropRequestHeaders []string
+
+	// ForwardRequestHeaders are the only headers passed to the
+	// function, unless it is empty
+	ForwardRequestHeaders []string
+
+	// BasicAuthUserFile and BasicAuthPasswordFile hold the credentials
+	// accepted with basic auth
+	BasicAuthUserFile     string
+	BasicAuthPasswordFile string
+
+	// BearerTokensFile holds the bearer tokens accepted, one per line
+	BearerTokensFile string
+
+	// HMACSecretFile holds the secret of the HMAC-SHA256 signature
+	// of the request body, sent in HMACSignatureHeader
+	HMACSecretFile      string
+	HMACSignatureHeader string
+
+	// TLSCertFile and TLSKeyFile enable TLS on the watchdog port,
+	// they are loaded again when they change
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSClientCAFile requires clients to present a certificate
+	// signed by one of its CAs
+	TLSClientCAFile string
+
+	// TLSReloadInterval is how often the certificate files are
+	// checked for changes
+	TLSReloadInterval time.Duration
+}
+
+// restartPolicies and readinessProbes are the values accepted for restart_policy and readiness_probe
+var (
+	restartPolicies = []string{"never", "on-failure", "always"}
+	readinessProbes = []string{"tcp", "http", "exec"}
+)
+
+// Validate returns an error for an option which is not one of its accepted values,
+// a status of exit_code_status which is not a valid HTTP status, or options which
+// need the environment of the request together with prefork_pool_size
+func (w WatchdogConfig) Validate() error {
+	if !contains(restartPolicies, w.RestartPolicy) {
+		return fmt.Errorf("unknown restart_policy: %q, accepted values are: %s", w.RestartPolicy, strings.Join(restartPolicies, ", "))
+	}
+
+	if len(w.ReadinessProbe) > 0 && !contains(readinessProbes, w.ReadinessProbe) {
+		return fmt.Errorf("unknown readiness_probe: %q, accepted values are: %s", w.ReadinessProbe, strings.Join(readinessProbes, ", "))
+	}
+
+	for exitCode, status := range w.ExitCodeStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid exit_code_status: %d:%d, the status must be between 100 and 599", exitCode, status)
+		}
+	}
+
+	// A preforked process is started before the request, so it cannot be given its environment
+	if w.PreforkPoolSize > 0 && w.InjectCGIHeaders {
+		return fmt.Errorf("prefork_pool_size cannot be used with inject_cgi_headers, set inject_cgi_headers=false")
+	}
+	if w.PreforkPoolSize > 0 && len(w.OTLPEndpoint) > 0 {
+		return fmt.Errorf("prefork_pool_size cannot be used with otel_exporter_otlp_endpoint, as TRACEPARENT is not passed to preforked processes")
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 // Process returns a string for the process and a slice for the arguments from the FunctionProcess.
@@ -92,13 +305,66 @@ func New(env []string) WatchdogConfig {
 		restoreLogPath = val
 	}
 
+	criuImagesDir := "/tmp/criu"
+	if val, exists := envMap["criu_images_dir"]; exists {
+		criuImagesDir = val
+	}
+
+	criuBinary := "criu"
+	if val, exists := envMap["criu_binary"]; exists {
+		criuBinary = val
+	}
+
+	readinessPath := "/"
+	if val, exists := envMap["readiness_path"]; exists {
+		readinessPath = val
+	}
+
+	injectCGIHeaders := true
+	if val, exists := envMap["inject_cgi_headers"]; exists {
+		injectCGIHeaders = val == "true"
+	}
+
+	otlpEndpoint := envMap["OTEL_EXPORTER_OTLP_ENDPOINT"]
+	if val, exists := envMap["otel_exporter_otlp_endpoint"]; exists {
+		otlpEndpoint = val
+	}
+
+	otelServiceName := "of-watchdog"
+	if val, exists := envMap["OTEL_SERVICE_NAME"]; exists {
+		otelServiceName = val
+	}
+	if val, exists := envMap["otel_service_name"]; exists {
+		otelServiceName = val
+	}
+
+	logFormat := "text"
+	if val, exists := envMap["log_format"]; exists {
+		logFormat = val
+	}
+
+	logLevel := "info"
+	if val, exists := envMap["log_level"]; exists {
+		logLevel = val
+	}
+
+	hmacSignatureHeader := "X-Hub-Signature"
+	if val, exists := envMap["hmac_signature_header"]; exists {
+		hmacSignatureHeader = val
+	}
+
+	restartPolicy := "never"
+	if val, exists := envMap["restart_policy"]; exists {
+		restartPolicy = val
+	}
+
 	config := WatchdogConfig{
 		TCPPort:          getInt(envMap, "port", 8080),
 		HTTPReadTimeout:  getDuration(envMap, "read_timeout", time.Second*10),
 		HTTPWriteTimeout: getDuration(envMap, "write_timeout", time.Second*10),
 		FunctionProcess:  functionProcess,
 		StaticPath:       staticPath,
-		InjectCGIHeaders: true,
+		InjectCGIHeaders: injectCGIHeaders,
 		ExecTimeout:      getDuration(envMap, "exec_timeout", time.Second*10),
 		OperationalMode:  ModeStreaming,
 		ContentType:      contentType,
@@ -109,6 +375,71 @@ func New(env []string) WatchdogConfig {
 		MaxInflight:      getInt(envMap, "max_inflight", 0),
 		CRIUExec:         getBool(envMap, "criu_exec"),
 		RestoreLogPath:   restoreLogPath,
+
+		BufferHTTPResponse: getBool(envMap, "http_buffer_res_body"),
+		HTTPFlushInterval:  getDuration(envMap, "http_flush_interval", time.Millisecond*100),
+		UpgradeIdleTimeout: getDuration(envMap, "upgrade_idle_timeout", 0),
+		H2C:                getBool(envMap, "h2c"),
+		UpstreamH2C:        getBool(envMap, "http_upstream_h2c"),
+
+		CRIUCheckpoint:    getBool(envMap, "criu_checkpoint"),
+		CRIUImagesDir:     criuImagesDir,
+		CRIUBinary:        criuBinary,
+		CRIUWarmupTimeout: getDuration(envMap, "criu_warmup_timeout", time.Second*30),
+
+		ReadinessProbe:    envMap["readiness_probe"],
+		ReadinessPath:     readinessPath,
+		ReadinessCommand:  envMap["readiness_command"],
+		ReadinessInterval: getDuration(envMap, "readiness_interval", time.Millisecond*100),
+		ReadinessTimeout:  getDuration(envMap, "readiness_timeout", time.Second*1),
+		ReadinessMaxWait:  getDuration(envMap, "readiness_max_wait", time.Second*30),
+
+		RestartPolicy:     restartPolicy,
+		RestartBackoff:    getDuration(envMap, "restart_backoff", time.Second*1),
+		RestartMaxBackoff: getDuration(envMap, "restart_max_backoff", time.Second*30),
+		MaxRestarts:       getInt(envMap, "max_restarts", 5),
+
+		AfterBurnWorkers: getInt(envMap, "afterburn_workers", 1),
+		PreforkPoolSize:  getInt(envMap, "prefork_pool_size", 0),
+		CGIResponse:      getBool(envMap, "cgi_response_headers"),
+		ExitCodeStatus:   getIntMap(envMap, "exit_code_status"),
+		IncludeStderr:    getBool(envMap, "include_stderr"),
+
+		AsyncWorkers:   getInt(envMap, "async_workers", 0),
+		AsyncQueueSize: getInt(envMap, "async_queue_size", 100),
+
+		InflightQueueDepth: getInt(envMap, "inflight_queue_depth", 0),
+
+		ResourceSampleInterval: getDuration(envMap, "resource_sample_interval", time.Second*5),
+
+		OTLPEndpoint:    otlpEndpoint,
+		OTelServiceName: otelServiceName,
+
+		LogFormat: logFormat,
+		LogLevel:  logLevel,
+		AccessLog: envMap["access_log"],
+
+		MaxRequestBytes:       int64(getInt(envMap, "max_request_bytes", 0)),
+		DropRequestHeaders:    getList(envMap, "drop_request_headers"),
+		ForwardRequestHeaders: getList(envMap, "forward_request_headers"),
+
+		BasicAuthUserFile:     envMap["basic_auth_user_file"],
+		BasicAuthPasswordFile: envMap["basic_auth_password_file"],
+		BearerTokensFile:      envMap["bearer_tokens_file"],
+		HMACSecretFile:        envMap["hmac_secret_file"],
+		HMACSignatureHeader:   hmacSignatureHeader,
+
+		TLSCertFile:       envMap["tls_cert_file"],
+		TLSKeyFile:        envMap["tls_key_file"],
+		TLSClientCAFile:   envMap["tls_client_ca_file"],
+		TLSReloadInterval: getDuration(envMap, "tls_reload_interval", time.Second*10),
+	}
+
+	config.AsyncTimeout = getDuration(envMap, "async_timeout", config.ExecTimeout)
+	config.InflightQueueWait = getDuration(envMap, "inflight_queue_wait", config.HTTPWriteTimeout)
+
+	if config.AfterBurnWorkers < 1 {
+		config.AfterBurnWorkers = 1
 	}
 
 	if val := envMap["mode"]; len(val) > 0 {
@@ -158,6 +489,40 @@ func getInt(env map[string]string, key string, defaultValue int) int {
 	return result
 }
 
+// getIntMap parses a list of key:value integer pairs i.e. "1:500,2:400", malformed pairs are skipped
+func getIntMap(env map[string]string, key string) map[int]int {
+	result := map[int]int{}
+
+	for _, pair := range strings.Split(env[key], ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		k, keyErr := strconv.Atoi(strings.TrimSpace(parts[0]))
+		v, valueErr := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if keyErr != nil || valueErr != nil {
+			continue
+		}
+		result[k] = v
+	}
+
+	return result
+}
+
+// getList parses a comma-separated list i.e. "Authorization, Cookie", empty items are skipped
+func getList(env map[string]string, key string) []string {
+	var result []string
+
+	for _, item := range strings.Split(env[key], ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
 func getBool(env map[string]string, key string) bool {
 	if env[key] == "true" {
 		return true
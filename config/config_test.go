@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -262,3 +263,321 @@ func Test_Timeouts(t *testing.T) {
 	}
 
 }
+
+func Test_CRIUCheckpoint_Defaults(t *testing.T) {
+	actual := New([]string{})
+
+	if actual.CRIUCheckpoint != false {
+		t.Errorf("CRIUCheckpoint want: %v, got: %v", false, actual.CRIUCheckpoint)
+	}
+	if actual.CRIUImagesDir != "/tmp/criu" {
+		t.Errorf("CRIUImagesDir want: %s, got: %s", "/tmp/criu", actual.CRIUImagesDir)
+	}
+	if actual.CRIUBinary != "criu" {
+		t.Errorf("CRIUBinary want: %s, got: %s", "criu", actual.CRIUBinary)
+	}
+	if actual.CRIUWarmupTimeout != time.Second*30 {
+		t.Errorf("CRIUWarmupTimeout want: %s, got: %s", time.Second*30, actual.CRIUWarmupTimeout)
+	}
+}
+
+func Test_CRIUCheckpoint_Override(t *testing.T) {
+	env := []string{
+		"criu_checkpoint=true",
+		"criu_images_dir=/var/criu",
+		"criu_binary=/usr/local/sbin/criu",
+		"criu_warmup_timeout=5s",
+	}
+
+	actual := New(env)
+
+	if actual.CRIUCheckpoint != true {
+		t.Errorf("CRIUCheckpoint want: %v, got: %v", true, actual.CRIUCheckpoint)
+	}
+	if actual.CRIUImagesDir != "/var/criu" {
+		t.Errorf("CRIUImagesDir want: %s, got: %s", "/var/criu", actual.CRIUImagesDir)
+	}
+	if actual.CRIUBinary != "/usr/local/sbin/criu" {
+		t.Errorf("CRIUBinary want: %s, got: %s", "/usr/local/sbin/criu", actual.CRIUBinary)
+	}
+	if actual.CRIUWarmupTimeout != time.Second*5 {
+		t.Errorf("CRIUWarmupTimeout want: %s, got: %s", time.Second*5, actual.CRIUWarmupTimeout)
+	}
+}
+
+func Test_Readiness_Defaults(t *testing.T) {
+	actual := New([]string{})
+
+	if actual.ReadinessProbe != "" {
+		t.Errorf("ReadinessProbe want: disabled, got: %s", actual.ReadinessProbe)
+	}
+	if actual.ReadinessPath != "/" {
+		t.Errorf("ReadinessPath want: %s, got: %s", "/", actual.ReadinessPath)
+	}
+	if actual.ReadinessInterval != time.Millisecond*100 {
+		t.Errorf("ReadinessInterval want: %s, got: %s", time.Millisecond*100, actual.ReadinessInterval)
+	}
+	if actual.ReadinessTimeout != time.Second {
+		t.Errorf("ReadinessTimeout want: %s, got: %s", time.Second, actual.ReadinessTimeout)
+	}
+	if actual.ReadinessMaxWait != time.Second*30 {
+		t.Errorf("ReadinessMaxWait want: %s, got: %s", time.Second*30, actual.ReadinessMaxWait)
+	}
+}
+
+func Test_Readiness_Override(t *testing.T) {
+	env := []string{
+		"readiness_probe=exec",
+		"readiness_path=/_/ready",
+		"readiness_command=cat /tmp/.ready",
+		"readiness_interval=1s",
+		"readiness_timeout=2s",
+		"readiness_max_wait=1m",
+	}
+
+	actual := New(env)
+
+	if actual.ReadinessProbe != "exec" {
+		t.Errorf("ReadinessProbe want: %s, got: %s", "exec", actual.ReadinessProbe)
+	}
+	if actual.ReadinessPath != "/_/ready" {
+		t.Errorf("ReadinessPath want: %s, got: %s", "/_/ready", actual.ReadinessPath)
+	}
+	if actual.ReadinessCommand != "cat /tmp/.ready" {
+		t.Errorf("ReadinessCommand want: %s, got: %s", "cat /tmp/.ready", actual.ReadinessCommand)
+	}
+	if actual.ReadinessInterval != time.Second {
+		t.Errorf("ReadinessInterval want: %s, got: %s", time.Second, actual.ReadinessInterval)
+	}
+	if actual.ReadinessTimeout != time.Second*2 {
+		t.Errorf("ReadinessTimeout want: %s, got: %s", time.Second*2, actual.ReadinessTimeout)
+	}
+	if actual.ReadinessMaxWait != time.Minute {
+		t.Errorf("ReadinessMaxWait want: %s, got: %s", time.Minute, actual.ReadinessMaxWait)
+	}
+}
+
+func Test_RestartPolicy_Defaults(t *testing.T) {
+	actual := New([]string{})
+
+	if actual.RestartPolicy != "never" {
+		t.Errorf("RestartPolicy want: %s, got: %s", "never", actual.RestartPolicy)
+	}
+	if actual.RestartBackoff != time.Second {
+		t.Errorf("RestartBackoff want: %s, got: %s", time.Second, actual.RestartBackoff)
+	}
+	if actual.RestartMaxBackoff != time.Second*30 {
+		t.Errorf("RestartMaxBackoff want: %s, got: %s", time.Second*30, actual.RestartMaxBackoff)
+	}
+	if actual.MaxRestarts != 5 {
+		t.Errorf("MaxRestarts want: %d, got: %d", 5, actual.MaxRestarts)
+	}
+}
+
+func Test_RestartPolicy_Override(t *testing.T) {
+	env := []string{
+		"restart_policy=on-failure",
+		"restart_backoff=500ms",
+		"restart_max_backoff=10s",
+		"max_restarts=0",
+	}
+
+	actual := New(env)
+
+	if actual.RestartPolicy != "on-failure" {
+		t.Errorf("RestartPolicy want: %s, got: %s", "on-failure", actual.RestartPolicy)
+	}
+	if actual.RestartBackoff != time.Millisecond*500 {
+		t.Errorf("RestartBackoff want: %s, got: %s", time.Millisecond*500, actual.RestartBackoff)
+	}
+	if actual.RestartMaxBackoff != time.Second*10 {
+		t.Errorf("RestartMaxBackoff want: %s, got: %s", time.Second*10, actual.RestartMaxBackoff)
+	}
+	if actual.MaxRestarts != 0 {
+		t.Errorf("MaxRestarts want: %d, got: %d", 0, actual.MaxRestarts)
+	}
+}
+
+func Test_AfterBurnWorkers(t *testing.T) {
+	cases := []struct {
+		env  []string
+		want int
+	}{
+		{[]string{}, 1},
+		{[]string{"afterburn_workers=4"}, 4},
+		{[]string{"afterburn_workers=0"}, 1},
+	}
+
+	for _, testCase := range cases {
+		actual := New(testCase.env)
+		if actual.AfterBurnWorkers != testCase.want {
+			t.Errorf("(%v) AfterBurnWorkers want: %d, got: %d", testCase.env, testCase.want, actual.AfterBurnWorkers)
+		}
+	}
+}
+
+func Test_PreforkPoolSize(t *testing.T) {
+	if actual := New([]string{}); actual.PreforkPoolSize != 0 {
+		t.Errorf("PreforkPoolSize want: %d, got: %d", 0, actual.PreforkPoolSize)
+	}
+
+	if actual := New([]string{"prefork_pool_size=3"}); actual.PreforkPoolSize != 3 {
+		t.Errorf("PreforkPoolSize want: %d, got: %d", 3, actual.PreforkPoolSize)
+	}
+}
+
+func Test_CGIResponse(t *testing.T) {
+	if actual := New([]string{}); actual.CGIResponse != false {
+		t.Errorf("CGIResponse want: %v, got: %v", false, actual.CGIResponse)
+	}
+
+	if actual := New([]string{"cgi_response_headers=true"}); actual.CGIResponse != true {
+		t.Errorf("CGIResponse want: %v, got: %v", true, actual.CGIResponse)
+	}
+}
+
+func Test_ExitCodeStatus(t *testing.T) {
+	actual := New([]string{"exit_code_status=1:500, 2:400,bad,3:teapot", "include_stderr=true"})
+
+	want := map[int]int{1: 500, 2: 400}
+	if len(actual.ExitCodeStatus) != len(want) {
+		t.Errorf("ExitCodeStatus want: %v, got: %v", want, actual.ExitCodeStatus)
+	}
+	for k, v := range want {
+		if actual.ExitCodeStatus[k] != v {
+			t.Errorf("ExitCodeStatus[%d] want: %d, got: %d", k, v, actual.ExitCodeStatus[k])
+		}
+	}
+
+	if actual.IncludeStderr != true {
+		t.Errorf("IncludeStderr want: %v, got: %v", true, actual.IncludeStderr)
+	}
+}
+
+func Test_HTTPResponseStreaming(t *testing.T) {
+	defaults := New([]string{})
+	if defaults.BufferHTTPResponse != false {
+		t.Errorf("BufferHTTPResponse want: %v, got: %v", false, defaults.BufferHTTPResponse)
+	}
+	if defaults.HTTPFlushInterval != time.Millisecond*100 {
+		t.Errorf("HTTPFlushInterval want: %s, got: %s", time.Millisecond*100, defaults.HTTPFlushInterval)
+	}
+
+	actual := New([]string{"http_buffer_res_body=true", "http_flush_interval=-1s"})
+	if actual.BufferHTTPResponse != true {
+		t.Errorf("BufferHTTPResponse want: %v, got: %v", true, actual.BufferHTTPResponse)
+	}
+	if actual.HTTPFlushInterval != -time.Second {
+		t.Errorf("HTTPFlushInterval want: %s, got: %s", -time.Second, actual.HTTPFlushInterval)
+	}
+}
+
+func Test_Logging(t *testing.T) {
+	actual := New([]string{})
+	if actual.LogFormat != "text" || actual.LogLevel != "info" {
+		t.Errorf("LogFormat, LogLevel want: %s, %s, got: %s, %s", "text", "info", actual.LogFormat, actual.LogLevel)
+	}
+
+	actual = New([]string{"log_format=json", "log_level=debug"})
+	if actual.LogFormat != "json" || actual.LogLevel != "debug" {
+		t.Errorf("LogFormat, LogLevel want: %s, %s, got: %s, %s", "json", "debug", actual.LogFormat, actual.LogLevel)
+	}
+}
+
+func Test_AccessLog(t *testing.T) {
+	if actual := New([]string{}); actual.AccessLog != "" {
+		t.Errorf("AccessLog want: %q, got: %q", "", actual.AccessLog)
+	}
+
+	if actual := New([]string{"access_log=combined"}); actual.AccessLog != "combined" {
+		t.Errorf("AccessLog want: %q, got: %q", "combined", actual.AccessLog)
+	}
+}
+
+func Test_RequestLimits(t *testing.T) {
+	actual := New([]string{})
+	if actual.MaxRequestBytes != 0 || actual.DropRequestHeaders != nil || actual.ForwardRequestHeaders != nil {
+		t.Errorf("want no request limits, got: %d %v %v", actual.MaxRequestBytes, actual.DropRequestHeaders, actual.ForwardRequestHeaders)
+	}
+
+	actual = New([]string{"max_request_bytes=1048576", "drop_request_headers=Authorization, Cookie,", "forward_request_headers=Content-Type"})
+	if actual.MaxRequestBytes != 1048576 {
+		t.Errorf("MaxRequestBytes want: %d, got: %d", 1048576, actual.MaxRequestBytes)
+	}
+	if strings.Join(actual.DropRequestHeaders, "|") != "Authorization|Cookie" {
+		t.Errorf("DropRequestHeaders want: %v, got: %v", []string{"Authorization", "Cookie"}, actual.DropRequestHeaders)
+	}
+	if strings.Join(actual.ForwardRequestHeaders, "|") != "Content-Type" {
+		t.Errorf("ForwardRequestHeaders want: %v, got: %v", []string{"Content-Type"}, actual.ForwardRequestHeaders)
+	}
+}
+
+func Test_Auth(t *testing.T) {
+	if actual := New([]string{}); actual.HMACSignatureHeader != "X-Hub-Signature" {
+		t.Errorf("HMACSignatureHeader want: %s, got: %s", "X-Hub-Signature", actual.HMACSignatureHeader)
+	}
+
+	actual := New([]string{"bearer_tokens_file=/var/openfaas/secrets/tokens", "hmac_secret_file=/var/openfaas/secrets/hmac", "hmac_signature_header=X-Signature"})
+	if actual.BearerTokensFile != "/var/openfaas/secrets/tokens" || actual.HMACSecretFile != "/var/openfaas/secrets/hmac" || actual.HMACSignatureHeader != "X-Signature" {
+		t.Errorf("want the secret files and header, got: %q %q %q", actual.BearerTokensFile, actual.HMACSecretFile, actual.HMACSignatureHeader)
+	}
+}
+
+func Test_TLS(t *testing.T) {
+	actual := New([]string{})
+	if actual.TLSCertFile != "" || actual.TLSReloadInterval != time.Second*10 {
+		t.Errorf("want TLS disabled and a 10s reload interval, got: %q %s", actual.TLSCertFile, actual.TLSReloadInterval)
+	}
+
+	actual = New([]string{"tls_cert_file=/certs/tls.crt", "tls_key_file=/certs/tls.key", "tls_client_ca_file=/certs/ca.crt", "tls_reload_interval=1m"})
+	if actual.TLSCertFile != "/certs/tls.crt" || actual.TLSKeyFile != "/certs/tls.key" || actual.TLSClientCAFile != "/certs/ca.crt" {
+		t.Errorf("want the TLS files, got: %q %q %q", actual.TLSCertFile, actual.TLSKeyFile, actual.TLSClientCAFile)
+	}
+	if actual.TLSReloadInterval != time.Minute {
+		t.Errorf("TLSReloadInterval want: %s, got: %s", time.Minute, actual.TLSReloadInterval)
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	if err := New([]string{"readiness_probe=http", "restart_policy=on-failure"}).Validate(); err != nil {
+		t.Errorf("want valid options accepted, got: %s", err)
+	}
+
+	err := New([]string{"restart_policy=onfailure"}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "never, on-failure, always") {
+		t.Errorf("want an error listing the restart policies, got: %v", err)
+	}
+
+	err = New([]string{"readiness_probe=tpc"}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "tcp, http, exec") {
+		t.Errorf("want an error listing the readiness probes, got: %v", err)
+	}
+}
+
+func Test_Validate_Prefork(t *testing.T) {
+	if err := New([]string{"prefork_pool_size=2", "inject_cgi_headers=false"}).Validate(); err != nil {
+		t.Errorf("want prefork accepted without CGI headers, got: %s", err)
+	}
+
+	err := New([]string{"prefork_pool_size=2"}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "inject_cgi_headers=false") {
+		t.Errorf("want an error for prefork with CGI headers, which are injected by default, got: %v", err)
+	}
+
+	err = New([]string{"prefork_pool_size=2", "inject_cgi_headers=false", "otel_exporter_otlp_endpoint=http://collector:4318"}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "TRACEPARENT") {
+		t.Errorf("want an error for prefork with tracing, got: %v", err)
+	}
+}
+
+func Test_Validate_ExitCodeStatus(t *testing.T) {
+	if err := New([]string{"exit_code_status=1:500,2:404"}).Validate(); err != nil {
+		t.Errorf("want valid statuses accepted, got: %s", err)
+	}
+
+	for _, invalid := range []string{"1:5", "1:600"} {
+		if err := New([]string{"exit_code_status=" + invalid}).Validate(); err == nil {
+			t.Errorf("want an error for exit_code_status=%s", invalid)
+		}
+	}
+}
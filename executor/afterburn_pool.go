@@ -0,0 +1,201 @@
+package executor
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/metrics"
+)
+
+// errNoHealthyWorker is returned when every worker is down, i.e. restarting or exited
+var errNoHealthyWorker = errors.New("no healthy afterburn worker")
+
+// errNoFreeWorker is returned when no worker became free within ExecTimeout
+var errNoFreeWorker = errors.New("no afterburn worker became free within exec_timeout")
+
+// AfterBurnPool dispatches each call to a free afterburn worker process
+type AfterBurnPool struct {
+	Workers     []*AfterBurnFunctionRunner
+	Metrics     *metrics.AfterBurn // Metrics records per-worker requests and health, optional
+	ExecTimeout time.Duration      // ExecTimeout bounds the wait for a free worker, disabled if 0
+
+	// OnHealthChange is called with false when no worker is healthy, and with true once one is
+	OnHealthChange func(healthy bool)
+
+	mutex  sync.Mutex
+	states []*workerState
+	free   chan int
+	down   chan struct{} // down is closed while no worker is healthy
+}
+
+type workerState struct {
+	healthy bool
+	busy    bool
+	queued  bool // queued is set while the worker is on the free list
+}
+
+// Start forks every worker process and puts the workers on the free list
+func (p *AfterBurnPool) Start() error {
+	p.free = make(chan int, len(p.Workers))
+	p.states = make([]*workerState, len(p.Workers))
+	p.down = make(chan struct{})
+
+	for i, worker := range p.Workers {
+		p.states[i] = &workerState{healthy: true, queued: true}
+		p.free <- i
+
+		if worker.Supervisor == nil {
+			worker.Supervisor = &Supervisor{Policy: RestartNever}
+		}
+
+		id := i
+		worker.Supervisor.OnHealthChange = func(healthy bool) {
+			p.setHealthy(id, healthy)
+		}
+
+		if p.Metrics != nil {
+			p.Metrics.WorkerHealthy.WithLabelValues(strconv.Itoa(i)).Set(1)
+		}
+
+		if err := worker.Start(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run waits for a free healthy worker and runs the call on it. The call is rejected
+// with 503 when no worker is healthy, or none became free within ExecTimeout.
+func (p *AfterBurnPool) Run(req FunctionRequest, contentLength int64, r *http.Request, w http.ResponseWriter) error {
+	id, err := p.acquire(r)
+	if err == errNoHealthyWorker || err == errNoFreeWorker {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer p.release(id)
+
+	if p.Metrics != nil {
+		p.Metrics.WorkerRequestsTotal.WithLabelValues(strconv.Itoa(id)).Inc()
+	}
+
+	worker := p.Workers[id]
+	worker.Mutex.Lock()
+	defer worker.Mutex.Unlock()
+
+	return worker.Run(req, contentLength, r, w)
+}
+
+func (p *AfterBurnPool) acquire(r *http.Request) (int, error) {
+	var timeout <-chan time.Time
+	if p.ExecTimeout > 0 {
+		timer := time.NewTimer(p.ExecTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		p.mutex.Lock()
+		down := p.down
+		p.mutex.Unlock()
+
+		select {
+		case id := <-p.free:
+			p.mutex.Lock()
+			state := p.states[id]
+			state.queued = false
+
+			// An unhealthy worker goes back on the free list once it has been restarted
+			if !state.healthy {
+				p.mutex.Unlock()
+				continue
+			}
+
+			state.busy = true
+			p.mutex.Unlock()
+
+			if p.Metrics != nil {
+				p.Metrics.WorkersBusy.Inc()
+			}
+			return id, nil
+		case <-down:
+			return 0, errNoHealthyWorker
+		case <-timeout:
+			return 0, errNoFreeWorker
+		case <-r.Context().Done():
+			return 0, r.Context().Err()
+		}
+	}
+}
+
+func (p *AfterBurnPool) release(id int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	state := p.states[id]
+	state.busy = false
+	p.enqueue(id)
+
+	if p.Metrics != nil {
+		p.Metrics.WorkersBusy.Dec()
+	}
+}
+
+func (p *AfterBurnPool) setHealthy(id int, healthy bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.states[id].healthy = healthy
+	if healthy {
+		p.enqueue(id)
+	}
+
+	if p.Metrics != nil {
+		value := 0.0
+		if healthy {
+			value = 1
+		}
+		p.Metrics.WorkerHealthy.WithLabelValues(strconv.Itoa(id)).Set(value)
+	}
+
+	anyHealthy := p.anyHealthy()
+	select {
+	case <-p.down:
+		if anyHealthy {
+			p.down = make(chan struct{})
+		}
+	default:
+		if !anyHealthy {
+			close(p.down)
+		}
+	}
+
+	if p.OnHealthChange != nil {
+		p.OnHealthChange(anyHealthy)
+	}
+}
+
+// enqueue puts a healthy idle worker on the free list, p.mutex must be held
+func (p *AfterBurnPool) enqueue(id int) {
+	state := p.states[id]
+	if state.healthy && !state.busy && !state.queued {
+		state.queued = true
+		p.free <- id
+	}
+}
+
+func (p *AfterBurnPool) anyHealthy() bool {
+	for _, state := range p.states {
+		if state.healthy {
+			return true
+		}
+	}
+	return false
+}
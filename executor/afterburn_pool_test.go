@@ -0,0 +1,154 @@
+package executor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startAfterBurnPool(t *testing.T, size int) *AfterBurnPool {
+	pool := &AfterBurnPool{}
+	for i := 0; i < size; i++ {
+		pool.Workers = append(pool.Workers, &AfterBurnFunctionRunner{
+			Process:     os.Args[0],
+			ProcessArgs: []string{"-test.run=TestAfterBurnHelperProcess"},
+		})
+	}
+
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	defer os.Unsetenv("GO_WANT_HELPER_PROCESS")
+
+	if err := pool.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func stopAfterBurnPool(pool *AfterBurnPool) {
+	for _, worker := range pool.Workers {
+		worker.Supervisor.Stop()
+	}
+}
+
+func TestAfterBurnPool_RunsConcurrently(t *testing.T) {
+	pool := startAfterBurnPool(t, 2)
+	defer stopAfterBurnPool(pool)
+
+	started := time.Now()
+
+	wg := sync.WaitGroup{}
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/slow", nil)
+			pool.Run(FunctionRequest{}, r.ContentLength, r, rr)
+			codes[i] = rr.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("want status: %d, got: %d", http.StatusOK, code)
+		}
+	}
+
+	if took := time.Since(started); took > time.Millisecond*350 {
+		t.Errorf("want both calls to run at the same time, took: %s", took)
+	}
+}
+
+func TestAfterBurnPool_SkipsUnhealthyWorker(t *testing.T) {
+	pool := startAfterBurnPool(t, 2)
+	defer stopAfterBurnPool(pool)
+
+	var health []bool
+	pool.OnHealthChange = func(healthy bool) {
+		health = append(health, healthy)
+	}
+
+	pool.setHealthy(0, false)
+
+	for i := 0; i < 3; i++ {
+		id, err := pool.acquire(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 1 {
+			t.Errorf("want worker: 1, got: %d", id)
+		}
+		pool.release(id)
+	}
+
+	pool.setHealthy(1, false)
+	pool.setHealthy(0, true)
+
+	want := []bool{true, false, true}
+	if len(health) != len(want) {
+		t.Fatalf("pool health want: %v, got: %v", want, health)
+	}
+	for i := range want {
+		if health[i] != want[i] {
+			t.Errorf("pool health want: %v, got: %v", want, health)
+		}
+	}
+}
+
+func TestAfterBurnPool_RejectsWithoutHealthyWorker(t *testing.T) {
+	pool := startAfterBurnPool(t, 1)
+	defer stopAfterBurnPool(pool)
+
+	pool.setHealthy(0, false)
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	done := make(chan struct{})
+	go func() {
+		pool.Run(FunctionRequest{}, r.ContentLength, r, rr)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("want the call rejected straight away")
+	}
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("want status: %d, got: %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	pool.setHealthy(0, true)
+	if rr := runPool(pool, "/ping"); rr.Code != http.StatusOK {
+		t.Errorf("want the call served once the worker is healthy, got: %d", rr.Code)
+	}
+}
+
+func TestAfterBurnPool_RejectsWhenNoWorkerFreeInTime(t *testing.T) {
+	pool := startAfterBurnPool(t, 1)
+	defer stopAfterBurnPool(pool)
+	pool.ExecTimeout = time.Millisecond * 50
+
+	id, err := pool.acquire(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.release(id)
+
+	if rr := runPool(pool, "/ping"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("want status: %d, got: %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
+
+func runPool(pool *AfterBurnPool, path string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	pool.Run(FunctionRequest{}, r.ContentLength, r, rr)
+	return rr
+}
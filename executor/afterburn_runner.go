@@ -2,17 +2,24 @@ package executor
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/admission"
+	"github.com/paulofelipefeitosa/of-watchdog/logging"
+	"github.com/paulofelipefeitosa/of-watchdog/tracing"
 )
 
 // AfterBurnFunctionRunner creates and maintains one process responsible for handling all calls
 type AfterBurnFunctionRunner struct {
+	ExecTimeout time.Duration // ExecTimeout kills and re-forks the process when a call takes longer, disabled if 0
 	Process     string
 	ProcessArgs []string
 	Command     *exec.Cmd
@@ -20,73 +27,186 @@ type AfterBurnFunctionRunner struct {
 	StdoutPipe  io.ReadCloser
 	Stderr      io.Writer
 	Mutex       sync.Mutex
+	Supervisor  *Supervisor      // Supervisor restarts the function when it exits, defaults to RestartNever
+	Sampler     *ResourceSampler // Sampler records the resource usage of the process, optional
+	Headers     *HeaderFilter    // Headers selects the request headers written to the process, optional
+
+	// processLock guards the process and its pipes, which are swapped on restart
+	processLock  sync.RWMutex
+	stdoutReader *bufio.Reader
 }
 
 // Start forks the process used for processing incoming requests
 func (f *AfterBurnFunctionRunner) Start() error {
-	cmd := exec.Command(f.Process, f.ProcessArgs...)
+	process, err := f.startProcess()
+	if err != nil {
+		return err
+	}
 
-	var stdinErr error
-	var stdoutErr error
+	if f.Supervisor == nil {
+		f.Supervisor = &Supervisor{Policy: RestartNever}
+	}
+	f.Supervisor.Supervise(process, f.startProcess)
 
-	f.Command = cmd
-	f.StdinPipe, stdinErr = cmd.StdinPipe()
+	if f.Sampler != nil {
+		go f.Sampler.Run(f.Supervisor.Process)
+	}
+
+	return nil
+}
+
+func (f *AfterBurnFunctionRunner) startProcess() (*os.Process, error) {
+	cmd := exec.Command(f.Process, f.ProcessArgs...)
+
+	stdinPipe, stdinErr := cmd.StdinPipe()
 	if stdinErr != nil {
-		return stdinErr
+		return nil, stdinErr
 	}
 
-	f.StdoutPipe, stdoutErr = cmd.StdoutPipe()
+	stdoutPipe, stdoutErr := cmd.StdoutPipe()
 	if stdoutErr != nil {
-		return stdoutErr
+		return nil, stdoutErr
 	}
 
 	errPipe, _ := cmd.StderrPipe()
 
 	// Prints stderr to console and is picked up by container logging driver.
-	bindLoggingPipe("stderr", errPipe, os.Stderr)
+	bindLoggingPipe("stderr", errPipe, os.Stderr, "")
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	f.processLock.Lock()
+	f.Command = cmd
+	f.StdinPipe = stdinPipe
+	f.StdoutPipe = stdoutPipe
+	// The reader is kept for the lifetime of the process so that no buffered bytes are lost between calls
+	f.stdoutReader = bufio.NewReader(stdoutPipe)
+	f.processLock.Unlock()
 
-	return cmd.Start()
+	return cmd.Process, nil
 }
 
 // Run a function with a long-running process with a HTTP protocol for communication
 func (f *AfterBurnFunctionRunner) Run(req FunctionRequest, contentLength int64, r *http.Request, w http.ResponseWriter) error {
+	startedTime := time.Now()
+	logger := logging.FromContext(r.Context())
+
+	f.processLock.RLock()
+	process := f.Command.Process
+	stdinPipe := f.StdinPipe
+	stdoutReader := f.stdoutReader
+	f.processLock.RUnlock()
+
+	var timedOut int32
+	if f.ExecTimeout > 0 {
+		timer := time.AfterFunc(f.ExecTimeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+
+			logger.Warn(fmt.Sprintf("Function was killed by ExecTimeout: %s", f.ExecTimeout.String()))
+			if killErr := f.Supervisor.Restart(process); killErr != nil {
+				logger.Error(fmt.Sprintf("Error killing function due to ExecTimeout: %s", killErr))
+			}
+		})
+		defer timer.Stop()
+	}
+
+	// The headers of the request itself are left as they are for the handlers it returns through
+	request := r.Clone(r.Context())
+	f.Headers.Apply(request.Header)
+
+	var body *bodyReader
+	if request.Body != nil && request.Body != http.NoBody {
+		body = &bodyReader{ReadCloser: request.Body}
+		request.Body = body
+	}
+
+	_, span := tracing.StartSpan(r.Context(), "afterburn", tracing.KindClient)
+	defer span.Finish()
+	if span != nil {
+		request.Header.Set(tracing.TraceparentHeader, span.Traceparent())
+	}
+
+	// failed writes a 504 when the function was killed by the timeout, a 413 when the
+	// body is over the limit, or a 502 when the function died or replied with a malformed response.
+	failed := func(err error) error {
+		span.SetError()
+		w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(startedTime).Seconds()))
+
+		if atomic.LoadInt32(&timedOut) == 1 {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return nil
+		}
+
+		// A partial request on stdin or an unread response on stdout would be
+		// taken as part of the next call, so the process is replaced
+		if killErr := f.Supervisor.Restart(process); killErr != nil {
+			logger.Error(fmt.Sprintf("Error killing function after a failed call: %s", killErr))
+		}
+
+		if admission.IsTooLarge(err) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte(err.Error()))
+			return nil
+		}
+
+		logger.Error(fmt.Sprintf("Forked function did not reply: %s", err.Error()))
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
 
 	// Submit body to function via stdin
-	writeErr := r.Write(f.StdinPipe)
+	writeErr := request.Write(stdinPipe)
 
 	if writeErr != nil {
-		return writeErr
+		if body != nil && body.err != nil {
+			writeErr = body.err
+		}
+		return failed(writeErr)
 	}
 
-	var processRes *http.Response
-
 	// Read response back from stdout
-	buffReader := bufio.NewReader(f.StdoutPipe)
-	var err1 error
-	processRes, err1 = http.ReadResponse(buffReader, r)
-	if err1 != nil {
-		return err1
+	processRes, readErr := http.ReadResponse(stdoutReader, request)
+	if readErr != nil {
+		return failed(readErr)
 	}
 
 	for h := range processRes.Header {
 		w.Header().Set(h, processRes.Header.Get(h))
 	}
+	w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(startedTime).Seconds()))
 
 	w.WriteHeader(processRes.StatusCode)
 	if processRes.Body != nil {
 		defer processRes.Body.Close()
-		bodyBytes, bodyErr := ioutil.ReadAll(processRes.Body)
-		if bodyErr != nil {
-			log.Println("read body err", bodyErr)
-		}
 
-		// processRes.Write(w)
-		w.Write(bodyBytes)
-	}
+		_, copyErr := io.Copy(w, processRes.Body)
+		if copyErr != nil {
+			logger.Error(fmt.Sprintf("read body err: %s", copyErr))
 
-	if processRes != nil {
-		log.Printf("%s %s - %s - ContentLength: %d\n", r.Method, r.RequestURI, processRes.Status, processRes.ContentLength)
+			// The remainder of the body must be consumed to keep the stdout pipe in step with the next call
+			io.Copy(ioutil.Discard, processRes.Body)
+		}
 	}
 
+	logger.Info(fmt.Sprintf("%s %s - %s - ContentLength: %d", r.Method, r.RequestURI, processRes.Status, processRes.ContentLength))
+
 	return nil
 }
+
+// bodyReader keeps the error of reading the request body, as Request.Write
+// returns it in a type which hides i.e. a http.MaxBytesError from errors.As
+type bodyReader struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
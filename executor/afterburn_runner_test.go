@@ -0,0 +1,212 @@
+package executor
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// TestAfterBurnHelperProcess is forked by the tests below to act as an afterburn function
+func TestAfterBurnHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			os.Exit(0)
+		}
+
+		switch req.URL.Path {
+		case "/sleep":
+			time.Sleep(time.Second * 5)
+		case "/slow":
+			time.Sleep(time.Millisecond * 200)
+		case "/crash":
+			os.Exit(1)
+		}
+
+		body := "hello " + req.URL.Path
+		if req.URL.Path == "/headers" {
+			body = "authorization: " + req.Header.Get("Authorization")
+		}
+		res := http.Response{
+			StatusCode:    http.StatusOK,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"text/plain"}},
+			Body:          ioutil.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+		}
+		res.Write(os.Stdout)
+	}
+}
+
+// startAfterBurnHelper forks the helper process, the caller must unset
+// GO_WANT_HELPER_PROCESS once it no longer needs the process to be re-forked.
+func startAfterBurnHelper(t *testing.T) *AfterBurnFunctionRunner {
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+
+	f := &AfterBurnFunctionRunner{
+		ExecTimeout: time.Millisecond * 500,
+		Process:     os.Args[0],
+		ProcessArgs: []string{"-test.run=TestAfterBurnHelperProcess"},
+		Supervisor: &Supervisor{
+			Policy:     RestartOnFailure,
+			Backoff:    time.Millisecond,
+			MaxBackoff: time.Millisecond * 10,
+		},
+	}
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func runAfterBurn(f *AfterBurnFunctionRunner, path string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+
+	f.Mutex.Lock()
+	defer f.Mutex.Unlock()
+	f.Run(FunctionRequest{}, r.ContentLength, r, rr)
+
+	return rr
+}
+
+// waitForAfterBurn retries until the re-forked process answers
+func waitForAfterBurn(t *testing.T, f *AfterBurnFunctionRunner) {
+	for i := 0; i < 50; i++ {
+		if rr := runAfterBurn(f, "/ping"); rr.Code == http.StatusOK {
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	t.Fatalf("function was not forked again")
+}
+
+func TestAfterBurn_StreamsResponse(t *testing.T) {
+	f := startAfterBurnHelper(t)
+	defer os.Unsetenv("GO_WANT_HELPER_PROCESS")
+	defer f.Supervisor.Stop()
+
+	for _, path := range []string{"/one", "/two"} {
+		rr := runAfterBurn(f, path)
+		if rr.Code != http.StatusOK {
+			t.Errorf("want status: %d, got: %d", http.StatusOK, rr.Code)
+		}
+		if rr.Body.String() != "hello "+path {
+			t.Errorf("want body: %q, got: %q", "hello "+path, rr.Body.String())
+		}
+	}
+}
+
+func TestAfterBurn_ExecTimeout(t *testing.T) {
+	f := startAfterBurnHelper(t)
+	defer os.Unsetenv("GO_WANT_HELPER_PROCESS")
+	defer f.Supervisor.Stop()
+
+	rr := runAfterBurn(f, "/sleep")
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("want status: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+
+	waitForAfterBurn(t, f)
+}
+
+func TestAfterBurn_CrashReturnsBadGateway(t *testing.T) {
+	f := startAfterBurnHelper(t)
+	defer os.Unsetenv("GO_WANT_HELPER_PROCESS")
+	defer f.Supervisor.Stop()
+
+	rr := runAfterBurn(f, "/crash")
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("want status: %d, got: %d", http.StatusBadGateway, rr.Code)
+	}
+
+	waitForAfterBurn(t, f)
+}
+
+func TestAfterBurn_TruncatedRequestRestartsFunction(t *testing.T) {
+	f := startAfterBurnHelper(t)
+	defer os.Unsetenv("GO_WANT_HELPER_PROCESS")
+	defer f.Supervisor.Stop()
+
+	process := f.Supervisor.Process()
+
+	// The client goes away after part of the body was written to the function
+	body := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("client went away")))
+	r := httptest.NewRequest(http.MethodPost, "/truncated", body)
+	r.ContentLength = 100
+
+	rr := httptest.NewRecorder()
+	f.Mutex.Lock()
+	f.Run(FunctionRequest{}, r.ContentLength, r, rr)
+	f.Mutex.Unlock()
+
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("want status: %d, got: %d", http.StatusBadGateway, rr.Code)
+	}
+
+	for i := 0; i < 50 && f.Supervisor.Process() == process; i++ {
+		time.Sleep(time.Millisecond * 20)
+	}
+	if f.Supervisor.Process() == process {
+		t.Fatalf("want the function re-forked after a truncated request")
+	}
+
+	if rr := runAfterBurn(f, "/next"); rr.Code != http.StatusOK || rr.Body.String() != "hello /next" {
+		t.Errorf("want the next call answered, got: %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAfterBurn_FiltersHeaders(t *testing.T) {
+	f := startAfterBurnHelper(t)
+	defer os.Unsetenv("GO_WANT_HELPER_PROCESS")
+	defer f.Supervisor.Stop()
+	f.Headers = NewHeaderFilter([]string{"Authorization"}, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/headers", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	f.Mutex.Lock()
+	f.Run(FunctionRequest{}, r.ContentLength, r, rr)
+	f.Mutex.Unlock()
+
+	if rr.Body.String() != "authorization: " {
+		t.Errorf("want Authorization dropped, got: %q", rr.Body.String())
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("want the headers of the request itself kept")
+	}
+}
+
+func TestAfterBurn_RequestTooLarge(t *testing.T) {
+	f := startAfterBurnHelper(t)
+	defer os.Unsetenv("GO_WANT_HELPER_PROCESS")
+	defer f.Supervisor.Stop()
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/large", strings.NewReader(strings.Repeat("x", 100)))
+	r.ContentLength = -1
+	r.Body = http.MaxBytesReader(rr, r.Body, 10)
+
+	f.Mutex.Lock()
+	f.Run(FunctionRequest{}, r.ContentLength, r, rr)
+	f.Mutex.Unlock()
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("want status: %d, got: %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+}
@@ -0,0 +1,45 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// parseCGIResponse splits the output of a function into a CGI header block and a body.
+// The "Status" header sets the status code, which defaults to 200 or to 302 when
+// only "Location" is given.
+func parseCGIResponse(output []byte) (int, http.Header, []byte, error) {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(output)))
+
+	mimeHeader, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("malformed CGI response headers: %s", err.Error())
+	}
+
+	body, err := ioutil.ReadAll(reader.R)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	header := http.Header(mimeHeader)
+	status := http.StatusOK
+
+	if value := header.Get("Status"); len(value) > 0 {
+		code := strings.SplitN(strings.TrimSpace(value), " ", 2)[0]
+		status, err = strconv.Atoi(code)
+		if err != nil || status < 100 || status > 999 {
+			return 0, nil, nil, fmt.Errorf("malformed CGI Status header: %q", value)
+		}
+		header.Del("Status")
+	} else if len(header.Get("Location")) > 0 {
+		status = http.StatusFound
+	}
+
+	return status, header, body, nil
+}
@@ -0,0 +1,112 @@
+package executor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseCGIResponse(t *testing.T) {
+	cases := []struct {
+		name       string
+		output     string
+		wantStatus int
+		wantHeader http.Header
+		wantBody   string
+		wantErr    bool
+	}{
+		{
+			name:       "status and headers",
+			output:     "Status: 404 Not Found\nContent-Type: text/plain\nCache-Control: max-age=60\n\nnot here",
+			wantStatus: http.StatusNotFound,
+			wantHeader: http.Header{"Content-Type": {"text/plain"}, "Cache-Control": {"max-age=60"}},
+			wantBody:   "not here",
+		},
+		{
+			name:       "CRLF and default status",
+			output:     "Content-Type: application/json\r\n\r\n{}",
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{"Content-Type": {"application/json"}},
+			wantBody:   "{}",
+		},
+		{
+			name:       "redirect",
+			output:     "Location: /elsewhere\n\n",
+			wantStatus: http.StatusFound,
+			wantHeader: http.Header{"Location": {"/elsewhere"}},
+			wantBody:   "",
+		},
+		{
+			name:    "no header block",
+			output:  "hello world\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad status",
+			output:  "Status: teapot\n\n",
+			wantErr: true,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			status, header, body, err := parseCGIResponse([]byte(testCase.output))
+			if testCase.wantErr {
+				if err == nil {
+					t.Errorf("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want no error, got: %s", err.Error())
+			}
+
+			if status != testCase.wantStatus {
+				t.Errorf("status want: %d, got: %d", testCase.wantStatus, status)
+			}
+			for k := range testCase.wantHeader {
+				if header.Get(k) != testCase.wantHeader.Get(k) {
+					t.Errorf("header %s want: %q, got: %q", k, testCase.wantHeader.Get(k), header.Get(k))
+				}
+			}
+			if len(header) != len(testCase.wantHeader) {
+				t.Errorf("headers want: %v, got: %v", testCase.wantHeader, header)
+			}
+			if string(body) != testCase.wantBody {
+				t.Errorf("body want: %q, got: %q", testCase.wantBody, string(body))
+			}
+		})
+	}
+}
+
+func TestSerializingForkFunctionRunner_CGIResponse(t *testing.T) {
+	f := &SerializingForkFunctionRunner{
+		CGIResponse: true,
+	}
+
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Content-Type", "application/octet-stream")
+
+	input := "Status: 400 Bad Request\nContent-Type: text/plain\n\ninvalid input"
+	contentLength := int64(len(input))
+	err := f.Run(FunctionRequest{
+		Process:       "cat",
+		InputReader:   ioutil.NopCloser(strings.NewReader(input)),
+		ContentLength: &contentLength,
+	}, rr)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err.Error())
+	}
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status want: %d, got: %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Content-Type want: %s, got: %s", "text/plain", rr.Header().Get("Content-Type"))
+	}
+	if rr.Body.String() != "invalid input" {
+		t.Errorf("body want: %q, got: %q", "invalid input", rr.Body.String())
+	}
+}
@@ -0,0 +1,153 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// descriptorsFile stores the stdio descriptors of the dumped process so that
+// they can be re-bound to new pipes on restore.
+const descriptorsFile = "descriptors.json"
+
+// CRIU drives checkpoint and restore of the function process through the criu binary
+type CRIU struct {
+	Binary    string // Binary is the path or name of the criu executable
+	ImagesDir string // ImagesDir holds the checkpoint images
+	LogPath   string // LogPath is where criu restore writes its log
+}
+
+// HasCheckpoint returns true when ImagesDir contains a complete dump.
+func (c *CRIU) HasCheckpoint() bool {
+	if _, err := os.Stat(filepath.Join(c.ImagesDir, "inventory.img")); err != nil {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(c.ImagesDir, descriptorsFile)); err != nil {
+		return false
+	}
+	return true
+}
+
+// Discard moves the checkpoint aside to ImagesDir with a .failed suffix, replacing an earlier
+// one, so that it can be inspected while the next start is cold and checkpoints again
+func (c *CRIU) Discard() error {
+	failedDir := filepath.Clean(c.ImagesDir) + ".failed"
+	if err := os.RemoveAll(failedDir); err != nil {
+		return err
+	}
+	return os.Rename(c.ImagesDir, failedDir)
+}
+
+// Dump checkpoints the process tree rooted at pid into ImagesDir and leaves it running.
+func (c *CRIU) Dump(pid int) error {
+	if err := os.MkdirAll(c.ImagesDir, 0755); err != nil {
+		return err
+	}
+
+	descriptors, err := readDescriptors(pid)
+	if err != nil {
+		return err
+	}
+
+	args := []string{
+		"dump",
+		"--tree", strconv.Itoa(pid),
+		"--images-dir", c.ImagesDir,
+		"--shell-job",
+		"--leave-running",
+		"--log-file", "dump.log",
+		"-v4",
+	}
+
+	log.Printf("Checkpointing pid %d to %s\n", pid, c.ImagesDir)
+	out, err := exec.Command(c.Binary, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("criu dump failed: %s, output: %s", err.Error(), strings.TrimSpace(string(out)))
+	}
+
+	descriptorsBytes, _ := json.Marshal(descriptors)
+	return ioutil.WriteFile(filepath.Join(c.ImagesDir, descriptorsFile), descriptorsBytes, 0644)
+}
+
+// Restore restores the process from ImagesDir as a sibling of criu, which makes
+// it a child of the watchdog. The stdio pipes of the restored process are
+// re-bound to stdin, stdout and stderr.
+func (c *CRIU) Restore(stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	descriptorsBytes, err := ioutil.ReadFile(filepath.Join(c.ImagesDir, descriptorsFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var descriptors []string
+	if err := json.Unmarshal(descriptorsBytes, &descriptors); err != nil {
+		return nil, err
+	}
+
+	logPath, err := filepath.Abs(c.LogPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pidFile := filepath.Join(c.ImagesDir, "restore.pid")
+	os.Remove(pidFile)
+
+	args := []string{
+		"restore",
+		"--images-dir", c.ImagesDir,
+		"--shell-job",
+		"--restore-detached",
+		"--restore-sibling",
+		"--pidfile", pidFile,
+		"--log-file", logPath,
+		"-v4",
+	}
+
+	cmd := exec.Command(c.Binary)
+	stdio := []*os.File{stdin, stdout, stderr}
+	for i, descriptor := range descriptors {
+		if i >= len(stdio) || !strings.HasPrefix(descriptor, "pipe:") {
+			continue
+		}
+		// ExtraFiles start at fd 3 in the criu process
+		args = append(args, "--inherit-fd", fmt.Sprintf("fd[%d]:%s", len(cmd.ExtraFiles)+3, descriptor))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, stdio[i])
+	}
+	cmd.Args = append(cmd.Args, args...)
+
+	log.Printf("Restoring function from %s\n", c.ImagesDir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("criu restore failed: %s, output: %s", err.Error(), strings.TrimSpace(string(out)))
+	}
+
+	pidBytes, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse restored pid %q: %s", string(pidBytes), err.Error())
+	}
+
+	return os.FindProcess(pid)
+}
+
+// readDescriptors returns the targets of the stdio descriptors of pid i.e. pipe:[1234]
+func readDescriptors(pid int) ([]string, error) {
+	var descriptors []string
+	for fd := 0; fd < 3; fd++ {
+		target, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, fd))
+		if err != nil {
+			return nil, err
+		}
+		descriptors = append(descriptors, target)
+	}
+	return descriptors, nil
+}
@@ -0,0 +1,158 @@
+package executor
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/metrics"
+)
+
+// fakeCRIU records its arguments and emulates the files written by criu dump and restore
+const fakeCRIU = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/args.log"
+dir=""
+pidfile=""
+while [ $# -gt 0 ]; do
+	case "$1" in
+		--images-dir) dir="$2"; shift ;;
+		--pidfile) pidfile="$2"; shift ;;
+	esac
+	shift
+done
+touch "$dir/inventory.img"
+if [ -n "$pidfile" ]; then
+	echo $$ > "$pidfile"
+fi
+`
+
+func makeFakeCRIU(t *testing.T) (string, string) {
+	binDir, err := ioutil.TempDir("", "fake-criu")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary := filepath.Join(binDir, "criu")
+	if err := ioutil.WriteFile(binary, []byte(fakeCRIU), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return binary, binDir
+}
+
+func TestCRIU_DumpThenRestore(t *testing.T) {
+	binary, binDir := makeFakeCRIU(t)
+	defer os.RemoveAll(binDir)
+
+	imagesDir := filepath.Join(binDir, "images")
+	c := CRIU{
+		Binary:    binary,
+		ImagesDir: imagesDir,
+		LogPath:   filepath.Join(binDir, "restore.log"),
+	}
+
+	if c.HasCheckpoint() {
+		t.Fatalf("HasCheckpoint want: false before dump")
+	}
+
+	cmd := exec.Command("sleep", "5")
+	cmd.StdinPipe()
+	cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	if err := c.Dump(cmd.Process.Pid); err != nil {
+		t.Fatalf("Dump want no error, got: %s", err.Error())
+	}
+
+	if !c.HasCheckpoint() {
+		t.Fatalf("HasCheckpoint want: true after dump")
+	}
+
+	stdinReader, stdinWriter, _ := os.Pipe()
+	stdoutReader, stdoutWriter, _ := os.Pipe()
+	stderrReader, stderrWriter, _ := os.Pipe()
+	defer stdinWriter.Close()
+	defer stdoutReader.Close()
+	defer stderrReader.Close()
+
+	process, err := c.Restore(stdinReader, stdoutWriter, stderrWriter)
+	if err != nil {
+		t.Fatalf("Restore want no error, got: %s", err.Error())
+	}
+	if process.Pid <= 0 {
+		t.Errorf("Restore want a pid, got: %d", process.Pid)
+	}
+
+	argsBytes, _ := ioutil.ReadFile(filepath.Join(binDir, "args.log"))
+	lines := strings.Split(strings.TrimSpace(string(argsBytes)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 invocations of criu, got: %d", len(lines))
+	}
+
+	if !strings.HasPrefix(lines[0], "dump --tree ") || !strings.Contains(lines[0], "--leave-running") {
+		t.Errorf("unexpected dump arguments: %s", lines[0])
+	}
+
+	if !strings.HasPrefix(lines[1], "restore ") || !strings.Contains(lines[1], "--restore-sibling") {
+		t.Errorf("unexpected restore arguments: %s", lines[1])
+	}
+
+	if !strings.Contains(lines[1], "--inherit-fd fd[3]:pipe:[") || !strings.Contains(lines[1], "--inherit-fd fd[4]:pipe:[") {
+		t.Errorf("want stdin and stdout pipes inherited, got: %s", lines[1])
+	}
+}
+
+func TestHTTPFunctionRunner_StartsColdWhenRestoreFails(t *testing.T) {
+	binDir, err := ioutil.TempDir("", "fake-criu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(binDir)
+
+	binary := filepath.Join(binDir, "criu")
+	failingCRIU := "#!/bin/sh\necho \"corrupt images\" >&2\nexit 1\n"
+	if err := ioutil.WriteFile(binary, []byte(failingCRIU), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	imagesDir := filepath.Join(binDir, "images")
+	os.MkdirAll(imagesDir, 0755)
+	ioutil.WriteFile(filepath.Join(imagesDir, "inventory.img"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(imagesDir, descriptorsFile), []byte(`["pipe:[1]","pipe:[2]","pipe:[3]"]`), 0644)
+
+	upstreamURL, _ := url.Parse("http://127.0.0.1:1")
+	f := &HTTPFunctionRunner{
+		Process:       "sleep",
+		ProcessArgs:   []string{"5"},
+		UpstreamURL:   upstreamURL,
+		WarmupTimeout: time.Millisecond,
+		CRIU: &CRIU{
+			Binary:    binary,
+			ImagesDir: imagesDir,
+			LogPath:   filepath.Join(binDir, "restore.log"),
+		},
+	}
+
+	if err := f.Start(); err != nil {
+		t.Fatalf("Start want no error, got: %s", err.Error())
+	}
+	defer f.Supervisor.Stop()
+
+	if f.start != metrics.StartCold || f.Command == nil {
+		t.Errorf("want fprocess started cold, got start: %s", f.start)
+	}
+	if f.CRIU.HasCheckpoint() {
+		t.Errorf("want the failed checkpoint moved out of %s", imagesDir)
+	}
+	if _, err := os.Stat(filepath.Join(imagesDir+".failed", "inventory.img")); err != nil {
+		t.Errorf("want the failed checkpoint kept for inspection: %s", err.Error())
+	}
+}
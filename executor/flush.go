@@ -0,0 +1,89 @@
+package executor
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// copyResponse streams body to w. Writes are flushed immediately when interval is
+// negative, otherwise at most interval after they were made. Server-sent events are
+// always flushed immediately.
+func copyResponse(w http.ResponseWriter, body io.Reader, interval time.Duration) (int64, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return io.Copy(w, body)
+	}
+
+	if w.Header().Get("Content-Type") == "text/event-stream" {
+		interval = -1
+	}
+
+	dst := &latencyWriter{
+		w:        w,
+		flusher:  flusher,
+		interval: interval,
+	}
+	defer dst.stop()
+
+	return io.Copy(dst, body)
+}
+
+// latencyWriter flushes the writes it receives at most interval after they were made
+type latencyWriter struct {
+	w        io.Writer
+	flusher  http.Flusher
+	interval time.Duration
+
+	mutex        sync.Mutex
+	timer        *time.Timer
+	flushPending bool
+}
+
+func (l *latencyWriter) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	n, err := l.w.Write(p)
+	if l.interval < 0 {
+		l.flusher.Flush()
+		return n, err
+	}
+
+	if l.flushPending {
+		return n, err
+	}
+
+	if l.timer == nil {
+		l.timer = time.AfterFunc(l.interval, l.delayedFlush)
+	} else {
+		l.timer.Reset(l.interval)
+	}
+	l.flushPending = true
+
+	return n, err
+}
+
+func (l *latencyWriter) delayedFlush() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// stop may have been called already
+	if !l.flushPending {
+		return
+	}
+
+	l.flusher.Flush()
+	l.flushPending = false
+}
+
+func (l *latencyWriter) stop() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.flushPending = false
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+}
@@ -0,0 +1,116 @@
+package executor
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyResponse_EventStreamFlushesEachWrite(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Content-Type", "text/event-stream")
+
+	_, err := copyResponse(rr, strings.NewReader("data: token\n\n"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rr.Flushed {
+		t.Errorf("want event stream to be flushed without waiting for the interval")
+	}
+}
+
+func TestLatencyWriter_FlushesAfterInterval(t *testing.T) {
+	rr := httptest.NewRecorder()
+	l := &latencyWriter{w: rr, flusher: rr, interval: time.Millisecond * 10}
+	defer l.stop()
+
+	l.Write([]byte("token"))
+
+	time.Sleep(time.Millisecond * 50)
+
+	l.mutex.Lock()
+	flushed := rr.Flushed
+	l.mutex.Unlock()
+
+	if !flushed {
+		t.Errorf("want write to be flushed after the interval")
+	}
+}
+
+func TestHTTPFunctionRunner_StreamsResponse(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+
+		<-release
+		w.Write([]byte("second\n"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	f := &HTTPFunctionRunner{
+		Client:        makeProxyClient(time.Second, upstreamURL, false),
+		UpstreamURL:   upstreamURL,
+		StartupTime:   0,
+		FlushInterval: -1,
+	}
+
+	watchdog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.Run(FunctionRequest{}, r.ContentLength, r, w)
+	}))
+	defer watchdog.Close()
+
+	res, err := http.Get(watchdog.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	reader := bufio.NewReader(res.Body)
+
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "first\n" {
+		t.Fatalf("want first line before the upstream completes, got: %q, %v", line, err)
+	}
+
+	close(release)
+
+	line, err = reader.ReadString('\n')
+	if err != nil || line != "second\n" {
+		t.Errorf("want second line, got: %q, %v", line, err)
+	}
+}
+
+func TestHTTPFunctionRunner_BufferedResponseHasContentLength(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("second\n"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	f := &HTTPFunctionRunner{
+		Client:             makeProxyClient(time.Second, upstreamURL, false),
+		UpstreamURL:        upstreamURL,
+		StartupTime:        0,
+		BufferHTTPResponse: true,
+	}
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	f.Run(FunctionRequest{}, r.ContentLength, r, rr)
+
+	if got := rr.Header().Get("Content-Length"); got != "13" {
+		t.Errorf("Content-Length want: %s, got: %s", "13", got)
+	}
+	if rr.Body.String() != "first\nsecond\n" {
+		t.Errorf("body want: %q, got: %q", "first\nsecond\n", rr.Body.String())
+	}
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"net/http"
+)
+
+// HeaderFilter selects the request headers which are passed to the function,
+// as CGI environment variables or as headers to the upstream. A nil filter passes every header.
+type HeaderFilter struct {
+	Drop    []string // Drop lists headers which are never passed on, i.e. Authorization
+	Forward []string // Forward lists the only headers passed on, unless it is empty
+}
+
+// NewHeaderFilter returns a filter for the drop and forward lists, or nil when both are empty
+func NewHeaderFilter(drop []string, forward []string) *HeaderFilter {
+	if len(drop) == 0 && len(forward) == 0 {
+		return nil
+	}
+	return &HeaderFilter{Drop: drop, Forward: forward}
+}
+
+// Allowed returns true when the header name is passed to the function
+func (f *HeaderFilter) Allowed(name string) bool {
+	if f == nil {
+		return true
+	}
+
+	name = http.CanonicalHeaderKey(name)
+	for _, drop := range f.Drop {
+		if http.CanonicalHeaderKey(drop) == name {
+			return false
+		}
+	}
+
+	if len(f.Forward) == 0 {
+		return true
+	}
+	for _, forward := range f.Forward {
+		if http.CanonicalHeaderKey(forward) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply removes the headers which are not passed to the function from header
+func (f *HeaderFilter) Apply(header http.Header) {
+	if f == nil {
+		return
+	}
+
+	for name := range header {
+		if !f.Allowed(name) {
+			header.Del(name)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package executor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeaderFilter_Allowed(t *testing.T) {
+	var passAll *HeaderFilter
+	if !passAll.Allowed("Authorization") {
+		t.Errorf("want a nil filter to pass every header")
+	}
+
+	drop := NewHeaderFilter([]string{"authorization"}, nil)
+	if drop.Allowed("Authorization") || !drop.Allowed("Content-Type") {
+		t.Errorf("want only Authorization dropped")
+	}
+
+	forward := NewHeaderFilter([]string{"X-Secret"}, []string{"content-type", "X-Secret"})
+	if !forward.Allowed("Content-Type") || forward.Allowed("Cookie") || forward.Allowed("X-Secret") {
+		t.Errorf("want only Content-Type forwarded")
+	}
+
+	if NewHeaderFilter(nil, nil) != nil {
+		t.Errorf("want no filter for empty lists")
+	}
+}
+
+func TestHTTPFunctionRunner_FiltersUpstreamHeaders(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	f := &HTTPFunctionRunner{
+		Client:      makeProxyClient(time.Second, upstreamURL, false),
+		UpstreamURL: upstreamURL,
+		Headers:     NewHeaderFilter([]string{"Authorization"}, nil),
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer gateway")
+	r.Header.Set("X-Tenant", "acme")
+
+	if err := f.Run(FunctionRequest{}, 0, r, httptest.NewRecorder()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Get("Authorization")) > 0 {
+		t.Errorf("want Authorization dropped, got: %q", got.Get("Authorization"))
+	}
+	if got.Get("X-Tenant") != "acme" {
+		t.Errorf("want X-Tenant forwarded, got: %q", got.Get("X-Tenant"))
+	}
+}
+
+func TestHTTPFunctionRunner_RequestTooLarge(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	f := &HTTPFunctionRunner{
+		Client:      makeProxyClient(time.Second, upstreamURL, false),
+		UpstreamURL: upstreamURL,
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Body = http.MaxBytesReader(w, ioutil.NopCloser(strings.NewReader("too large")), 4)
+
+	f.Run(FunctionRequest{}, -1, r, w)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status want: %d, got: %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
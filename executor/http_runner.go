@@ -12,11 +12,15 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
-	"os/signal"
-	"regexp"
 	"strconv"
-	"syscall"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/admission"
+	"github.com/paulofelipefeitosa/of-watchdog/logging"
+	"github.com/paulofelipefeitosa/of-watchdog/metrics"
+	"github.com/paulofelipefeitosa/of-watchdog/tracing"
 )
 
 // HTTPFunctionRunner creates and maintains one process responsible for handling all calls
@@ -33,61 +37,313 @@ type HTTPFunctionRunner struct {
 	UpstreamURL    *url.URL
 	BufferHTTPBody bool
 	StartupTime    int64
+
+	// BufferHTTPResponse reads the whole upstream response before writing it,
+	// otherwise it is streamed and flushed every FlushInterval, or after each
+	// write when FlushInterval is negative.
+	BufferHTTPResponse bool
+	FlushInterval      time.Duration
+
+	// UpstreamH2C speaks HTTP/2 without TLS to the upstream, i.e. for gRPC functions
+	UpstreamH2C bool
+
+	// UpgradeIdleTimeout closes an upgraded connection, i.e. a WebSocket, after
+	// no data has been read for this long. When not set ExecTimeout bounds its lifetime.
+	UpgradeIdleTimeout time.Duration
+
 	CRIUExec       bool
 	RestoreLogPath string
+	CRIU           *CRIU            // CRIU checkpoints the function once warm and restores it on later boots
+	WarmupTimeout  time.Duration    // WarmupTimeout is the maximum wait for the upstream to respond for the first time
+	RestoreStats   *RestoreStats    // RestoreStats holds the phases of the CRIU restore, when CRIUExec is set
+	StartupMetrics *metrics.Startup // StartupMetrics records startup time, optional
+	Readiness      *ReadinessProbe  // Readiness gates WaitReady until the upstream is ready, optional
+	Supervisor     *Supervisor      // Supervisor restarts the function when it exits, defaults to RestartNever
+	Sampler        *ResourceSampler // Sampler records the resource usage of the process, optional
+	Headers        *HeaderFilter    // Headers selects the request headers sent to the upstream, optional
+
+	mutex       sync.Mutex // mutex guards start and startedTime, which change when the process is restarted
+	start       string     // start is metrics.StartCold or metrics.StartRestored
+	startupOnce sync.Once
+	ready       chan struct{} // ready is closed once warmup has finished
+	readyTime   time.Time     // readyTime is when the upstream was first ready
+	readyErr    error
+
+	startedTime time.Time // startedTime is when the current process was started
+	healthyOnce sync.Once // healthyOnce records the first healthy response, when there is no warmup
 }
 
-// Start forks the process used for processing incoming requests
+// defaultWarmupTimeout bounds the wait for the upstream to respond for the first time
+const defaultWarmupTimeout = 30 * time.Second
+
+// Start forks the process used for processing incoming requests. When CRIU is
+// configured and a checkpoint exists, the process is restored instead.
 func (f *HTTPFunctionRunner) Start() error {
-	cmd := exec.Command(f.Process, f.ProcessArgs...)
+	f.Client = makeProxyClient(f.ExecTimeout, f.UpstreamURL, f.UpstreamH2C)
+	f.ready = make(chan struct{})
+
+	startedTime := time.Now()
+	process, start, err := f.startProcess()
+	if err != nil {
+		return err
+	}
 
-	var stdinErr error
-	var stdoutErr error
+	f.setStart(start, startedTime)
+	if start == metrics.StartRestored && f.CRIU != nil {
+		// Startup time is now read from the restore log
+		f.CRIUExec = true
+		f.RestoreLogPath = f.CRIU.LogPath
+	}
 
-	f.Command = cmd
-	f.StdinPipe, stdinErr = cmd.StdinPipe()
+	if f.Supervisor == nil {
+		f.Supervisor = &Supervisor{Policy: RestartNever}
+	}
+	if f.Readiness != nil && f.Supervisor.Ready == nil {
+		// A restarted process is only healthy once it passes the probe again
+		f.Supervisor.Ready = func() error {
+			_, err := f.Readiness.Wait()
+			return err
+		}
+	}
+	f.Supervisor.Supervise(process, func() (*os.Process, error) {
+		startedTime := time.Now()
+		process, start, err := f.startProcess()
+		if err != nil {
+			return nil, err
+		}
+		f.setStart(start, startedTime)
+		return process, nil
+	})
+
+	if f.Sampler != nil {
+		go f.Sampler.Run(f.Supervisor.Process)
+	}
+
+	// Without a probe or a checkpoint to take, the upstream is not polled, as that would
+	// call the function; the first response to a request marks it as healthy instead
+	if f.CRIU != nil || f.Readiness != nil {
+		go f.warmup(startedTime, process.Pid)
+	}
+
+	return nil
+}
+
+// startProcess forks fprocess, or restores it when a checkpoint exists. It
+// returns metrics.StartCold or metrics.StartRestored for the process.
+func (f *HTTPFunctionRunner) startProcess() (*os.Process, string, error) {
+	if f.CRIU != nil && f.CRIU.HasCheckpoint() {
+		process, err := f.restore()
+		if err == nil {
+			return process, metrics.StartRestored, nil
+		}
+
+		// A stale or corrupt checkpoint must not keep the function from starting
+		log.Printf("Unable to restore function, starting it cold: %s\n", err.Error())
+		if discardErr := f.CRIU.Discard(); discardErr != nil {
+			log.Printf("Unable to move checkpoint aside: %s\n", discardErr.Error())
+		}
+	}
+
+	start := f.startLabel()
+	startedTime := time.Now()
+
+	cmd := exec.Command(f.Process, f.ProcessArgs...)
+
+	stdinPipe, stdinErr := cmd.StdinPipe()
 	if stdinErr != nil {
-		return stdinErr
+		return nil, start, stdinErr
 	}
 
-	f.StdoutPipe, stdoutErr = cmd.StdoutPipe()
+	stdoutPipe, stdoutErr := cmd.StdoutPipe()
 	if stdoutErr != nil {
-		return stdoutErr
+		return nil, start, stdoutErr
 	}
 
 	errPipe, _ := cmd.StderrPipe()
 
 	// Logs lines from stderr and stdout to the stderr and stdout of this process
-	bindLoggingPipe("stderr", errPipe, os.Stderr)
-	bindLoggingPipe("stdout", f.StdoutPipe, os.Stdout)
+	bindLoggingPipe("stderr", errPipe, os.Stderr, "")
+	bindLoggingPipe("stdout", stdoutPipe, os.Stdout, "")
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, start, err
+	}
 
-	f.Client = makeProxyClient(f.ExecTimeout)
+	f.Command = cmd
+	f.StdinPipe = stdinPipe
+	f.StdoutPipe = stdoutPipe
 
-	go func() {
-		sig := make(chan os.Signal, 1)
-		signal.Notify(sig, syscall.SIGTERM)
+	f.observeStart(start, time.Since(startedTime))
 
-		<-sig
-		cmd.Process.Signal(syscall.SIGTERM)
+	return cmd.Process, start, nil
+}
 
-	}()
+// restore brings the function back from its CRIU checkpoint and binds new stdio pipes to it
+func (f *HTTPFunctionRunner) restore() (*os.Process, error) {
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
 
-	err := cmd.Start()
-	go func() {
-		err := cmd.Wait()
-		if err != nil {
-			log.Fatalf("Forked function has terminated: %s", err.Error())
+	startedTime := time.Now()
+
+	process, restoreErr := f.CRIU.Restore(stdinReader, stdoutWriter, stderrWriter)
+
+	// The restored process holds its own copies of these ends
+	stdinReader.Close()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+
+	if restoreErr != nil {
+		stdinWriter.Close()
+		stdoutReader.Close()
+		stderrReader.Close()
+		return nil, restoreErr
+	}
+
+	f.StdinPipe = stdinWriter
+	f.StdoutPipe = stdoutReader
+
+	bindLoggingPipe("stderr", stderrReader, os.Stderr, "")
+	bindLoggingPipe("stdout", stdoutReader, os.Stdout, "")
+
+	log.Printf("Restored function with pid: %d\n", process.Pid)
+	restoreDuration := time.Since(startedTime)
+	f.observeStart(metrics.StartRestored, restoreDuration)
+	if f.StartupMetrics != nil {
+		f.StartupMetrics.RestoreDurationSeconds.Set(restoreDuration.Seconds())
+	}
+
+	return process, nil
+}
+
+// setStart records how the current process was started and when, also for the Sampler
+func (f *HTTPFunctionRunner) setStart(start string, startedTime time.Time) {
+	f.mutex.Lock()
+	f.start = start
+	f.startedTime = startedTime
+	f.mutex.Unlock()
+
+	if f.Sampler != nil {
+		f.Sampler.SetStart(start)
+	}
+}
+
+// currentStart returns how the current process was started and when
+func (f *HTTPFunctionRunner) currentStart() (string, time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.start, f.startedTime
+}
+
+// observeStart records how long it took to fork or restore the function process
+func (f *HTTPFunctionRunner) observeStart(start string, duration time.Duration) {
+	if f.StartupMetrics != nil {
+		f.StartupMetrics.ProcessStartSeconds.WithLabelValues(start).Set(duration.Seconds())
+	}
+}
+
+// observeFirstHealthy records how long the function took to respond for the first time
+func (f *HTTPFunctionRunner) observeFirstHealthy(startedTime time.Time, healthyTime time.Time) {
+	if f.StartupMetrics != nil {
+		start, _ := f.currentStart()
+		f.StartupMetrics.FirstHealthySeconds.WithLabelValues(start).Set(healthyTime.Sub(startedTime).Seconds())
+	}
+}
+
+// warmup waits for the upstream to be ready for the first time, then checkpoints
+// the function when it was cold-started and CRIU is configured.
+func (f *HTTPFunctionRunner) warmup(startedTime time.Time, pid int) {
+	readyTime, err := f.waitForReady()
+
+	f.readyTime = readyTime
+	f.readyErr = err
+	close(f.ready)
+
+	if err != nil {
+		log.Printf("Upstream is not ready: %s\n", err.Error())
+		return
+	}
+
+	f.observeFirstHealthy(startedTime, readyTime)
+
+	if start, _ := f.currentStart(); f.CRIU == nil || start == metrics.StartRestored {
+		return
+	}
+
+	if err := f.CRIU.Dump(pid); err != nil {
+		log.Printf("Unable to checkpoint function: %s\n", err.Error())
+		return
+	}
+
+	log.Printf("Checkpoint written to %s\n", f.CRIU.ImagesDir)
+}
+
+// waitForReady uses the readiness probe when configured, otherwise any HTTP response from the upstream
+func (f *HTTPFunctionRunner) waitForReady() (time.Time, error) {
+	if f.Readiness != nil {
+		return f.Readiness.Wait()
+	}
+
+	timeout := f.WarmupTimeout
+	if timeout <= 0 {
+		timeout = defaultWarmupTimeout
+	}
+
+	if err := waitForUpstream(f.Client, f.UpstreamURL, timeout); err != nil {
+		return time.Time{}, fmt.Errorf("no response within %s: %s", timeout, err.Error())
+	}
+	return time.Now(), nil
+}
+
+// WaitReady blocks until the readiness probe passes or gives up. It returns
+// immediately when no readiness probe is configured.
+func (f *HTTPFunctionRunner) WaitReady() error {
+	if f.Readiness == nil {
+		return nil
+	}
+
+	<-f.ready
+	return f.readyErr
+}
+
+// waitForUpstream polls upstreamURL until it answers with any HTTP response or timeout elapses
+func waitForUpstream(client *http.Client, upstreamURL *url.URL, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		res, err := client.Get(upstreamHTTPURL(upstreamURL).String())
+		if err == nil {
+			res.Body.Close()
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return err
 		}
-	}()
 
-	return err
+		time.Sleep(100 * time.Millisecond)
+	}
 }
 
 // Run a function with a long-running process with a HTTP protocol for communication
 func (f *HTTPFunctionRunner) Run(req FunctionRequest, contentLength int64, r *http.Request, w http.ResponseWriter) error {
+	if isUpgrade(r) {
+		return f.proxyUpgrade(r, w)
+	}
+
 	startedTime := time.Now()
 
-	upstreamURL := f.UpstreamURL.String()
+	upstreamURL := upstreamHTTPURL(f.UpstreamURL).String()
 
 	if len(r.RequestURI) > 0 {
 		upstreamURL += r.RequestURI
@@ -108,6 +364,16 @@ func (f *HTTPFunctionRunner) Run(req FunctionRequest, contentLength int64, r *ht
 
 	request.Host = r.Host
 	copyHeaders(request.Header, &r.Header)
+	f.Headers.Apply(request.Header)
+
+	logger := logging.FromContext(r.Context())
+
+	_, span := tracing.StartSpan(r.Context(), "proxy", tracing.KindClient)
+	span.SetAttribute("server.address", f.UpstreamURL.String())
+	defer span.Finish()
+	if span != nil {
+		request.Header.Set(tracing.TraceparentHeader, span.Traceparent())
+	}
 
 	var reqCtx context.Context
 	var cancel context.CancelFunc
@@ -126,12 +392,17 @@ func (f *HTTPFunctionRunner) Run(req FunctionRequest, contentLength int64, r *ht
 	res, err := f.Client.Do(request.WithContext(reqCtx))
 
 	if err != nil {
-		log.Printf("Upstream HTTP request error: %s\n", err.Error())
+		logger.Error(fmt.Sprintf("Upstream HTTP request error: %s", err.Error()))
+		span.SetError()
 
 		// Error unrelated to context / deadline
 		if reqCtx.Err() == nil {
 			w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(startedTime).Seconds()))
 
+			if admission.IsTooLarge(err) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return nil
+			}
 			w.WriteHeader(http.StatusInternalServerError)
 
 			return nil
@@ -142,7 +413,7 @@ func (f *HTTPFunctionRunner) Run(req FunctionRequest, contentLength int64, r *ht
 			{
 				if reqCtx.Err() != nil {
 					// Error due to timeout / deadline
-					log.Printf("Upstream HTTP killed due to exec_timeout: %s\n", f.ExecTimeout)
+					logger.Warn(fmt.Sprintf("Upstream HTTP killed due to exec_timeout: %s", f.ExecTimeout))
 					w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(startedTime).Seconds()))
 
 					w.WriteHeader(http.StatusGatewayTimeout)
@@ -157,57 +428,141 @@ func (f *HTTPFunctionRunner) Run(req FunctionRequest, contentLength int64, r *ht
 		return err
 	}
 
+	span.SetAttribute("http.response.status_code", strconv.Itoa(res.StatusCode))
+	if res.StatusCode >= http.StatusInternalServerError {
+		span.SetError()
+	}
+
 	copyHeaders(w.Header(), &res.Header)
 
 	w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(startedTime).Seconds()))
-	if f.StartupTime == -1 {
-		f.StartupTime = getStartupTime(f.CRIUExec, f.RestoreLogPath, res.Header.Get("X-App-Startup-Timestamp"))
+	f.startupOnce.Do(func() {
+		f.recordStartup(res.Header.Get("X-App-Startup-Timestamp"))
+	})
+	if res.StatusCode < http.StatusInternalServerError && f.CRIU == nil && f.Readiness == nil {
+		f.healthyOnce.Do(func() {
+			_, startedTime := f.currentStart()
+			f.observeFirstHealthy(startedTime, time.Now())
+		})
 	}
 	w.Header().Set("X-App-Startup-Time", fmt.Sprintf("%d", f.StartupTime))
+	if f.RestoreStats != nil {
+		for _, phase := range f.RestoreStats.Phases() {
+			w.Header().Set(restorePhaseHeader(phase.Name), fmt.Sprintf("%d", phase.Duration.Nanoseconds()))
+		}
+	}
 
-	w.WriteHeader(res.StatusCode)
-	if res.Body != nil {
-		defer res.Body.Close()
+	defer res.Body.Close()
 
+	if f.BufferHTTPResponse {
+		// Buffering gives the client a Content-Length even when the upstream used chunked encoding
 		bodyBytes, bodyErr := ioutil.ReadAll(res.Body)
 		if bodyErr != nil {
-			log.Println("read body err", bodyErr)
+			logger.Error(fmt.Sprintf("read body err: %s", bodyErr))
 		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(bodyBytes)))
+		w.WriteHeader(res.StatusCode)
 		w.Write(bodyBytes)
+	} else {
+		w.WriteHeader(res.StatusCode)
+
+		if _, copyErr := copyResponse(w, res.Body, f.FlushInterval); copyErr != nil {
+			logger.Error(fmt.Sprintf("stream body err: %s", copyErr))
+		}
 	}
 
-	log.Printf("%s %s - %s - ContentLength: %d", r.Method, r.RequestURI, res.Status, res.ContentLength)
+	// Trailers such as grpc-status are only known once the body has been read
+	for k, v := range res.Trailer {
+		w.Header()[http.TrailerPrefix+k] = v
+	}
+
+	logger.Info(fmt.Sprintf("%s %s - %s - ContentLength: %d", r.Method, r.RequestURI, res.Status, res.ContentLength))
 
 	return nil
 }
 
-func getStartupTime(CRIUExec bool, restoreLogPath string, strAppStartupTS string) int64 {
-	if CRIUExec {
-		lastLine := string(tail(restoreLogPath))
-		re := regexp.MustCompile(`\((\d+\.\d+)\) Writing stats`)
-		log.Printf("Last Line: %v", lastLine)
-		result := re.FindAllStringSubmatch(lastLine, -1)[0][1]
-		s, err := strconv.ParseFloat(result, 64)
+// recordStartup computes the startup time of the function, and the restore phases
+// when the function was restored by CRIU.
+func (f *HTTPFunctionRunner) recordStartup(strAppStartupTS string) {
+	// The restore log is parsed once, for both the startup time and the restore phases
+	if f.CRIUExec && f.RestoreStats == nil {
+		stats, err := ReadRestoreStats(f.RestoreLogPath)
 		if err != nil {
-			log.Printf("Found %s, but cannot convert %s to float64\n", lastLine, result)
-			return 0
+			log.Printf("Cannot read restore statistics from %s: %s\n", f.RestoreLogPath, err.Error())
+		} else {
+			f.RestoreStats = &stats
 		}
-		log.Printf("Found %s and converted %s to %f\n", lastLine, result, s)
-		return int64(s * 1e9)
-	} else {
-		strContainerStartupTS := os.Getenv("CONTAINER_STARTUP_TS")
-		containerStartupTS, err := strconv.ParseInt(strContainerStartupTS, 10, 64)
-		if err != nil {
-			log.Printf("Cannot convert container startup timestamp value (%s) to int64, due to %v\n", strContainerStartupTS, err.Error())
-			return 0
+	}
+
+	if f.StartupTime == -1 {
+		// The readiness probe gives an exact timestamp for when the upstream became ready
+		if f.Readiness != nil {
+			select {
+			case <-f.ready:
+				if f.readyErr == nil {
+					strAppStartupTS = strconv.FormatInt(f.readyTime.UnixNano(), 10)
+				}
+			default:
+			}
 		}
-		appStartupTS, err := strconv.ParseInt(strAppStartupTS, 10, 64)
-		if err != nil {
-			log.Printf("Cannot convert app startup timestamp value (%s) to int64, due to %v\n", strAppStartupTS, err.Error())
+		f.StartupTime = getStartupTime(f.CRIUExec, f.RestoreStats, strAppStartupTS)
+	}
+
+	if f.StartupMetrics != nil {
+		start, _ := f.currentStart()
+		f.StartupMetrics.FunctionStartupSeconds.WithLabelValues(start).Set(time.Duration(f.StartupTime).Seconds())
+	}
+
+	if f.RestoreStats == nil || f.StartupMetrics == nil {
+		return
+	}
+
+	for _, phase := range f.RestoreStats.Phases() {
+		f.StartupMetrics.RestorePhaseSeconds.WithLabelValues(phase.Name).Set(phase.Duration.Seconds())
+	}
+}
+
+// startLabel labels fprocess as restored when CRIUExec is set, as it restores the function itself
+func (f *HTTPFunctionRunner) startLabel() string {
+	if f.CRIUExec {
+		return metrics.StartRestored
+	}
+	return metrics.StartCold
+}
+
+// getStartupTime returns the total restore time from stats when CRIUExec is set, which
+// is nil when the restore log could not be read, otherwise the time since the container started
+func getStartupTime(CRIUExec bool, stats *RestoreStats, strAppStartupTS string) int64 {
+	if CRIUExec {
+		if stats == nil {
 			return 0
 		}
-		return appStartupTS - containerStartupTS
+		log.Printf("Restore took %s\n", stats.WritingStats)
+		return stats.WritingStats.Nanoseconds()
+	}
+
+	strContainerStartupTS := os.Getenv("CONTAINER_STARTUP_TS")
+	containerStartupTS, err := strconv.ParseInt(strContainerStartupTS, 10, 64)
+	if err != nil {
+		log.Printf("Cannot convert container startup timestamp value (%s) to int64, due to %v\n", strContainerStartupTS, err.Error())
+		return 0
 	}
+	appStartupTS, err := strconv.ParseInt(strAppStartupTS, 10, 64)
+	if err != nil {
+		log.Printf("Cannot convert app startup timestamp value (%s) to int64, due to %v\n", strAppStartupTS, err.Error())
+		return 0
+	}
+	return appStartupTS - containerStartupTS
+}
+
+// restorePhaseHeader returns the response header for a restore phase i.e. X-Restore-Network-Unlock-Time
+func restorePhaseHeader(phase string) string {
+	parts := strings.Split(phase, "_")
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	return fmt.Sprintf("X-Restore-%s-Time", strings.Join(parts, "-"))
 }
 
 func copyHeaders(destination http.Header, source *http.Header) {
@@ -218,14 +573,20 @@ func copyHeaders(destination http.Header, source *http.Header) {
 	}
 }
 
-func makeProxyClient(dialTimeout time.Duration) *http.Client {
+func makeProxyClient(dialTimeout time.Duration, upstreamURL *url.URL, h2c bool) *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if upstreamURL != nil && upstreamURL.Scheme == UnixSocketScheme {
+		// A HTTP proxy can't reach a socket inside the container
+		proxy = nil
+	}
+
 	proxyClient := http.Client{
 		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
+			Proxy: proxy,
+			DialContext: dialUpstream(&net.Dialer{
 				Timeout:   dialTimeout,
 				KeepAlive: 10 * time.Second,
-			}).DialContext,
+			}, upstreamURL),
 			MaxIdleConns:          100,
 			MaxIdleConnsPerHost:   100,
 			DisableKeepAlives:     false,
@@ -237,5 +598,12 @@ func makeProxyClient(dialTimeout time.Duration) *http.Client {
 		},
 	}
 
+	if h2c {
+		// HTTP/2 with prior knowledge, without the HTTP/1.1 Upgrade round-trip
+		protocols := new(http.Protocols)
+		protocols.SetUnencryptedHTTP2(true)
+		proxyClient.Transport.(*http.Transport).Protocols = protocols
+	}
+
 	return &proxyClient
 }
@@ -4,21 +4,34 @@ import (
 	"bufio"
 	"io"
 	"log"
+
+	"github.com/paulofelipefeitosa/of-watchdog/logging"
 )
 
 // bindLoggingPipe spawns a goroutine for passing through logging of the given output pipe.
-func bindLoggingPipe(name string, pipe io.Reader, output io.Writer) {
+// Each line is logged with callID when the process serves a single call, otherwise callID is "".
+// The returned channel is closed once the pipe has been read to the end.
+func bindLoggingPipe(name string, pipe io.Reader, output io.Writer, callID string) <-chan struct{} {
 	log.Printf("Started logging %s from function.", name)
 
 	scanner := bufio.NewScanner(pipe)
-	logger := log.New(output, log.Prefix(), log.Flags())
+	logger := logging.New(output).With("stream", name)
+	if len(callID) > 0 {
+		logger = logger.With("call_id", callID)
+	}
+
+	done := make(chan struct{})
 
 	go func() {
+		defer close(done)
+
 		for scanner.Scan() {
-			logger.Printf("%s: %s", name, scanner.Text())
+			logger.Info(scanner.Text())
 		}
 		if err := scanner.Err(); err != nil {
 			log.Printf("Error scanning %s: %s", name, err.Error())
 		}
 	}()
+
+	return done
 }
@@ -0,0 +1,160 @@
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/logging"
+)
+
+// PreforkPool keeps processes started ahead of time, blocked on stdin, so that
+// fork, exec and runtime initialisation are not paid for by the call.
+type PreforkPool struct {
+	Process     string
+	ProcessArgs []string
+	Size        int // Size is the number of processes kept warm
+
+	ready chan *PreforkedProcess
+}
+
+// PreforkedProcess is a started process waiting for its input
+type PreforkedProcess struct {
+	Cmd    *exec.Cmd
+	Stdin  io.WriteCloser
+	Stdout io.ReadCloser
+	Stderr io.ReadCloser // Stderr must be read, or closed, by the caller, i.e. with bindLoggingPipe
+
+	mutex     sync.Mutex
+	handedOut bool
+	exited    bool           // exited is set once stderr is closed, which the process does when it exits
+	relay     *io.PipeWriter // relay passes stderr on to Stderr once the process is handed out
+}
+
+// Start forks Size processes
+func (p *PreforkPool) Start() error {
+	p.ready = make(chan *PreforkedProcess, p.Size)
+
+	for i := 0; i < p.Size; i++ {
+		process, err := p.fork()
+		if err != nil {
+			return err
+		}
+		p.ready <- process
+	}
+
+	return nil
+}
+
+// Get hands out a warm process and forks its replacement in the background.
+// A process which has exited while it was waiting is discarded.
+func (p *PreforkPool) Get() *PreforkedProcess {
+	for {
+		process := <-p.ready
+
+		go p.replace()
+
+		if process.handOut() {
+			return process
+		}
+
+		log.Printf("Discarding preforked %s which has exited\n", p.Process)
+		process.Cmd.Wait()
+	}
+}
+
+func (p *PreforkPool) replace() {
+	for {
+		process, err := p.fork()
+		if err == nil {
+			p.ready <- process
+			return
+		}
+
+		log.Printf("Unable to prefork %s: %s, retrying\n", p.Process, err.Error())
+		time.Sleep(time.Second)
+	}
+}
+
+func (p *PreforkPool) fork() (*PreforkedProcess, error) {
+	cmd := exec.Command(p.Process, p.ProcessArgs...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	process := &PreforkedProcess{
+		Cmd:    cmd,
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: reader,
+		relay:  writer,
+	}
+
+	go process.relayStderr(stderr)
+
+	return process, nil
+}
+
+// relayStderr keeps reading stderr while the process waits in the pool, so that
+// output written during its initialisation can't fill the pipe and block it.
+// Lines are logged until the process is handed out, then passed on to Stderr.
+func (p *PreforkedProcess) relayStderr(stderr io.Reader) {
+	logger := logging.New(os.Stderr).With("stream", "stderr")
+
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		p.mutex.Lock()
+		handedOut := p.handedOut
+		p.mutex.Unlock()
+
+		if handedOut {
+			// An error means the caller closed Stderr, the rest is still read to let the process exit
+			fmt.Fprintln(p.relay, scanner.Text())
+		} else {
+			logger.Info(scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error scanning stderr: %s", err.Error())
+	}
+
+	p.mutex.Lock()
+	p.exited = true
+	p.mutex.Unlock()
+
+	p.relay.Close()
+}
+
+// handOut passes stderr on to Stderr from now on, it returns false if the process has exited
+func (p *PreforkedProcess) handOut() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.exited {
+		return false
+	}
+	p.handedOut = true
+	return true
+}
@@ -0,0 +1,179 @@
+package executor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreforkPool_ReplacesHandedOutProcess(t *testing.T) {
+	pool := PreforkPool{
+		Process: "cat",
+		Size:    2,
+	}
+	if err := pool.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	process := pool.Get()
+	process.Stdin.Close()
+	process.Cmd.Wait()
+
+	// The replacement is forked in the background
+	for i := 0; i < 50 && len(pool.ready) < 2; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if len(pool.ready) != 2 {
+		t.Errorf("want 2 warm processes, got: %d", len(pool.ready))
+	}
+
+	for len(pool.ready) > 0 {
+		process := <-pool.ready
+		process.Cmd.Process.Kill()
+		process.Cmd.Wait()
+	}
+}
+
+func TestForkFunctionRunner_Preforked(t *testing.T) {
+	pool := &PreforkPool{
+		Process: "cat",
+		Size:    1,
+	}
+	if err := pool.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := ForkFunctionRunner{
+		ExecTimeout: time.Second,
+		Prefork:     pool,
+	}
+
+	for _, input := range []string{"one", "two"} {
+		output := bytes.Buffer{}
+		err := f.Run(FunctionRequest{
+			Process:      "cat",
+			InputReader:  ioutil.NopCloser(strings.NewReader(input)),
+			OutputWriter: &output,
+		})
+		if err != nil {
+			t.Fatalf("want no error, got: %s", err.Error())
+		}
+		if output.String() != input {
+			t.Errorf("want output: %q, got: %q", input, output.String())
+		}
+	}
+}
+
+func TestSerializingForkFunctionRunner_Preforked(t *testing.T) {
+	pool := &PreforkPool{
+		Process: "cat",
+		Size:    1,
+	}
+	if err := pool.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &SerializingForkFunctionRunner{
+		ExecTimeout: time.Second,
+		Prefork:     pool,
+	}
+
+	input := "hello"
+	contentLength := int64(len(input))
+	output, err := serializeFunction(FunctionRequest{
+		Process:       "cat",
+		InputReader:   ioutil.NopCloser(strings.NewReader(input)),
+		ContentLength: &contentLength,
+	}, f)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err.Error())
+	}
+	if string(*output) != input {
+		t.Errorf("want output: %q, got: %q", input, string(*output))
+	}
+}
+
+// runThrough writes input to a pooled process and returns its output, or fails after a second
+func runThrough(t *testing.T, process *PreforkedProcess, input string) string {
+	go ioutil.ReadAll(process.Stderr)
+
+	output := make(chan string, 1)
+	go func() {
+		process.Stdin.Write([]byte(input))
+		process.Stdin.Close()
+		out, _ := ioutil.ReadAll(process.Stdout)
+		output <- string(out)
+	}()
+
+	select {
+	case out := <-output:
+		process.Cmd.Wait()
+		return out
+	case <-time.After(time.Second):
+		process.Cmd.Process.Kill()
+		t.Fatalf("pooled process did not reply")
+		return ""
+	}
+}
+
+func TestPreforkPool_DrainsStderrWhileWaiting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prefork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Well over a pipe buffer is written to stderr during initialisation
+	initialised := filepath.Join(dir, "initialised")
+	pool := PreforkPool{
+		Process:     "sh",
+		ProcessArgs: []string{"-c", "seq 1 30000 >&2; touch " + initialised + "; cat"},
+		Size:        1,
+	}
+	if err := pool.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(initialised); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if _, err := os.Stat(initialised); err != nil {
+		t.Errorf("want the pooled process to finish initialising before it is handed out")
+	}
+
+	if out := runThrough(t, pool.Get(), "hello"); out != "hello" {
+		t.Errorf("want output: %q, got: %q", "hello", out)
+	}
+}
+
+func TestPreforkPool_DiscardsExitedProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prefork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The first process exits straight away, its replacements wait for input
+	marker := filepath.Join(dir, "forked")
+	pool := PreforkPool{
+		Process:     "sh",
+		ProcessArgs: []string{"-c", "if [ -e " + marker + " ]; then cat; else touch " + marker + "; fi"},
+		Size:        1,
+	}
+	if err := pool.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 200)
+
+	if out := runThrough(t, pool.Get(), "hello"); out != "hello" {
+		t.Errorf("want output from a live process: %q, got: %q", "hello", out)
+	}
+}
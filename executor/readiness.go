@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"time"
+)
+
+const (
+	// ProbeTCP is ready once a TCP connection to the upstream can be opened
+	ProbeTCP = "tcp"
+
+	// ProbeHTTP is ready once a GET to the upstream returns a 2xx or 3xx status
+	ProbeHTTP = "http"
+
+	// ProbeExec is ready once a command exits with status 0
+	ProbeExec = "exec"
+)
+
+// ReadinessProbe checks whether the upstream is ready to receive requests
+type ReadinessProbe struct {
+	Type        string        // Type is one of ProbeTCP, ProbeHTTP or ProbeExec
+	UpstreamURL *url.URL      // UpstreamURL of the function for the tcp and http probes, may be a unix socket
+	Path        string        // Path to GET for the http probe
+	Command     []string      // Command to run for the exec probe
+	Interval    time.Duration // Interval between two probes
+	Timeout     time.Duration // Timeout of a single probe
+	MaxWait     time.Duration // MaxWait before giving up on the upstream
+}
+
+// Probe checks the upstream once and returns an error if it is not ready
+func (p *ReadinessProbe) Probe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+
+	switch p.Type {
+	case ProbeTCP:
+		network, address := upstreamAddress(p.UpstreamURL)
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case ProbeHTTP:
+		probeURL := *upstreamHTTPURL(p.UpstreamURL)
+		probeURL.Path = p.Path
+
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialContext:       dialUpstream(&net.Dialer{}, p.UpstreamURL),
+				DisableKeepAlives: true,
+			},
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, probeURL.String(), nil)
+		res, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		if res.StatusCode < 200 || res.StatusCode >= 400 {
+			return fmt.Errorf("readiness probe %s returned status %d", probeURL.String(), res.StatusCode)
+		}
+		return nil
+	case ProbeExec:
+		if len(p.Command) == 0 {
+			return fmt.Errorf("no command given for exec readiness probe")
+		}
+		return exec.CommandContext(ctx, p.Command[0], p.Command[1:]...).Run()
+	default:
+		return fmt.Errorf("unknown readiness probe: %q", p.Type)
+	}
+}
+
+// Wait probes the upstream every Interval until it is ready, and returns the time it became ready
+func (p *ReadinessProbe) Wait() (time.Time, error) {
+	deadline := time.Now().Add(p.MaxWait)
+	for {
+		err := p.Probe()
+		if err == nil {
+			return time.Now(), nil
+		}
+
+		if time.Now().After(deadline) {
+			return time.Time{}, fmt.Errorf("not ready after %s: %s", p.MaxWait, err.Error())
+		}
+
+		time.Sleep(p.Interval)
+	}
+}
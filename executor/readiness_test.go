@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func makeProbe(probeType string, upstream string) *ReadinessProbe {
+	upstreamURL, _ := url.Parse(upstream)
+	return &ReadinessProbe{
+		Type:        probeType,
+		UpstreamURL: upstreamURL,
+		Path:        "/_/ready",
+		Interval:    time.Millisecond * 10,
+		Timeout:     time.Millisecond * 100,
+		MaxWait:     time.Millisecond * 50,
+	}
+}
+
+func TestReadinessProbe_HTTP(t *testing.T) {
+	var ready int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_/ready" || atomic.LoadInt32(&ready) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	probe := makeProbe(ProbeHTTP, srv.URL)
+
+	if err := probe.Probe(); err == nil {
+		t.Errorf("want an error while the upstream is not ready")
+	}
+
+	atomic.StoreInt32(&ready, 1)
+	if err := probe.Probe(); err != nil {
+		t.Errorf("want no error, got: %s", err.Error())
+	}
+}
+
+func TestReadinessProbe_TCP(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	probe := makeProbe(ProbeTCP, srv.URL)
+
+	if err := probe.Probe(); err != nil {
+		t.Errorf("want no error, got: %s", err.Error())
+	}
+
+	srv.Close()
+	if _, err := probe.Wait(); err == nil {
+		t.Errorf("want an error once the listener is closed")
+	}
+}
+
+func TestReadinessProbe_Exec(t *testing.T) {
+	probe := makeProbe(ProbeExec, "http://127.0.0.1:8080")
+
+	probe.Command = []string{"true"}
+	if _, err := probe.Wait(); err != nil {
+		t.Errorf("want no error, got: %s", err.Error())
+	}
+
+	probe.Command = []string{"false"}
+	if _, err := probe.Wait(); err == nil {
+		t.Errorf("want an error when the command fails")
+	}
+}
+
+func TestReadinessProbe_Unknown(t *testing.T) {
+	probe := makeProbe("grpc", "http://127.0.0.1:8080")
+
+	if err := probe.Probe(); err == nil {
+		t.Errorf("want an error for an unknown probe")
+	}
+}
@@ -0,0 +1,132 @@
+package executor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/metrics"
+)
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc/<pid>/stat, which is 100 on Linux
+const clockTicks = 100
+
+// Usage is the resource usage of a function process
+type Usage struct {
+	CPU         time.Duration // CPU is user plus system time
+	RSS         int64         // RSS in bytes, the maximum RSS for an exited process
+	MinorFaults int64
+	MajorFaults int64
+}
+
+// observeUsage records the usage of a forked process once it has exited
+func observeUsage(resources *metrics.Resources, state *os.ProcessState, start string) {
+	if resources == nil || state == nil {
+		return
+	}
+
+	usage, ok := processUsage(state)
+	if !ok {
+		return
+	}
+
+	resources.CPUSeconds.WithLabelValues(start).Observe(usage.CPU.Seconds())
+	resources.MaxRSSBytes.WithLabelValues(start).Observe(float64(usage.RSS))
+	resources.PageFaults.WithLabelValues(start, "minor").Observe(float64(usage.MinorFaults))
+	resources.PageFaults.WithLabelValues(start, "major").Observe(float64(usage.MajorFaults))
+}
+
+// ResourceSampler records the usage of a long-running function process from /proc every Interval
+type ResourceSampler struct {
+	Metrics  *metrics.Resources
+	Interval time.Duration
+	Process  string // Process labels the samples, i.e. with the afterburn worker
+	Start    string // Start is metrics.StartCold or metrics.StartRestored, see SetStart once Run was called
+
+	mutex sync.Mutex
+}
+
+// SetStart labels the samples of a restarted process with how it was started,
+// the samples of the previous process are removed when the label changes
+func (s *ResourceSampler) SetStart(start string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if start == s.Start {
+		return
+	}
+
+	if s.Metrics != nil {
+		s.Metrics.SampledCPUSeconds.DeleteLabelValues(s.Process, s.Start)
+		s.Metrics.SampledRSSBytes.DeleteLabelValues(s.Process, s.Start)
+		s.Metrics.SampledPageFaults.DeleteLabelValues(s.Process, s.Start, "minor")
+		s.Metrics.SampledPageFaults.DeleteLabelValues(s.Process, s.Start, "major")
+	}
+	s.Start = start
+}
+
+// Run samples the process returned by current until the watchdog exits
+func (s *ResourceSampler) Run(current func() *os.Process) {
+	for {
+		time.Sleep(s.Interval)
+
+		process := current()
+		if process == nil {
+			continue
+		}
+
+		// The process may be restarting, in which case the next sample is taken from its replacement
+		usage, err := readProcUsage("/proc", process.Pid)
+		if err != nil {
+			continue
+		}
+
+		s.mutex.Lock()
+		s.Metrics.SampledCPUSeconds.WithLabelValues(s.Process, s.Start).Set(usage.CPU.Seconds())
+		s.Metrics.SampledRSSBytes.WithLabelValues(s.Process, s.Start).Set(float64(usage.RSS))
+		s.Metrics.SampledPageFaults.WithLabelValues(s.Process, s.Start, "minor").Set(float64(usage.MinorFaults))
+		s.Metrics.SampledPageFaults.WithLabelValues(s.Process, s.Start, "major").Set(float64(usage.MajorFaults))
+		s.mutex.Unlock()
+	}
+}
+
+// readProcUsage parses <procPath>/<pid>/stat, see proc(5)
+func readProcUsage(procPath string, pid int) (Usage, error) {
+	stat, err := ioutil.ReadFile(filepath.Join(procPath, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return Usage{}, err
+	}
+
+	// The command name is in parentheses and may itself contain spaces
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return Usage{}, fmt.Errorf("unable to parse stat of pid %d", pid)
+	}
+
+	// fields starts at the third field of proc(5), the state
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 22 {
+		return Usage{}, fmt.Errorf("unable to parse stat of pid %d", pid)
+	}
+
+	values := map[int]int64{}
+	for _, field := range []int{10, 12, 14, 15, 24} {
+		value, err := strconv.ParseInt(fields[field-3], 10, 64)
+		if err != nil {
+			return Usage{}, fmt.Errorf("unable to parse field %d of stat of pid %d: %s", field, pid, err.Error())
+		}
+		values[field] = value
+	}
+
+	return Usage{
+		CPU:         time.Duration(values[14]+values[15]) * time.Second / clockTicks,
+		RSS:         values[24] * int64(os.Getpagesize()),
+		MinorFaults: values[10],
+		MajorFaults: values[12],
+	}, nil
+}
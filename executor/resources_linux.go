@@ -0,0 +1,21 @@
+package executor
+
+import (
+	"os"
+	"syscall"
+)
+
+// processUsage reads the rusage of an exited process
+func processUsage(state *os.ProcessState) (Usage, bool) {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return Usage{}, false
+	}
+
+	return Usage{
+		CPU:         state.UserTime() + state.SystemTime(),
+		RSS:         int64(rusage.Maxrss) * 1024, // Maxrss is in kilobytes on Linux
+		MinorFaults: int64(rusage.Minflt),
+		MajorFaults: int64(rusage.Majflt),
+	}, true
+}
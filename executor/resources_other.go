@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package executor
+
+import "os"
+
+// processUsage is only implemented on Linux
+func processUsage(state *os.ProcessState) (Usage, bool) {
+	return Usage{}, false
+}
@@ -0,0 +1,71 @@
+package executor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/metrics"
+)
+
+func TestReadProcUsage(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(procPath)
+
+	os.MkdirAll(filepath.Join(procPath, "42"), 0755)
+
+	// The command name contains a space and a parenthesis
+	stat := "42 (my (fn) x) S 1 42 42 0 -1 4194560 1500 0 7 0 250 50 0 0 20 0 1 0 100 10000000 256 18446744073709551615\n"
+	ioutil.WriteFile(filepath.Join(procPath, "42", "stat"), []byte(stat), 0644)
+
+	usage, err := readProcUsage(procPath, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usage.CPU != time.Second*3 {
+		t.Errorf("want CPU %s, got: %s", time.Second*3, usage.CPU)
+	}
+	if want := int64(256 * os.Getpagesize()); usage.RSS != want {
+		t.Errorf("want RSS %d, got: %d", want, usage.RSS)
+	}
+	if usage.MinorFaults != 1500 || usage.MajorFaults != 7 {
+		t.Errorf("want 1500 minor and 7 major faults, got: %d and %d", usage.MinorFaults, usage.MajorFaults)
+	}
+}
+
+func TestReadProcUsage_Self(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+
+	usage, err := readProcUsage("/proc", os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usage.RSS <= 0 {
+		t.Errorf("want a positive RSS, got: %d", usage.RSS)
+	}
+}
+
+func TestHTTPFunctionRunner_RestartedProcessLabelsSampler(t *testing.T) {
+	f := &HTTPFunctionRunner{
+		Sampler: &ResourceSampler{Process: "0", Start: metrics.StartCold},
+	}
+
+	restartedTime := time.Now()
+	f.setStart(metrics.StartRestored, restartedTime)
+
+	if start, startedTime := f.currentStart(); start != metrics.StartRestored || !startedTime.Equal(restartedTime) {
+		t.Errorf("want the restarted process recorded, got: %s %s", start, startedTime)
+	}
+	if f.Sampler.Start != metrics.StartRestored {
+		t.Errorf("want samples labelled %s, got: %s", metrics.StartRestored, f.Sampler.Start)
+	}
+}
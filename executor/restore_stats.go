@@ -0,0 +1,132 @@
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// restoreLogLine matches a timestamped criu log line i.e. "(00.533888) Writing stats"
+var restoreLogLine = regexp.MustCompile(`^\((\d+)\.(\d{6})\)\s*(.*)$`)
+
+// RestoreStats holds the offset of each phase of a restore, i.e. the time elapsed since criu restore
+// started until the phase began. Phases gives the time spent in each phase instead.
+type RestoreStats struct {
+	Fork            time.Duration // Fork of the first restored task
+	MemoryRestore   time.Duration // MemoryRestore starts when the restorer blob takes over to remap memory
+	NetworkUnlock   time.Duration // NetworkUnlock of the restored tasks
+	RestoreFinished time.Duration // RestoreFinished when criu resumes the restored tasks
+	WritingStats    time.Duration // WritingStats is the last phase of a restore, its offset is the total restore time
+}
+
+// RestorePhase is a named phase of a CRIU restore
+type RestorePhase struct {
+	Name     string
+	Duration time.Duration // Duration from the end of the previous phase, or the start of the restore, until this phase
+}
+
+// restoreMarkers maps the message which opens each phase to its field in RestoreStats
+var restoreMarkers = []struct {
+	marker string
+	field  func(*RestoreStats) *time.Duration
+}{
+	{"Forking task with", func(s *RestoreStats) *time.Duration { return &s.Fork }},
+	{"Restore via sigreturn", func(s *RestoreStats) *time.Duration { return &s.MemoryRestore }},
+	{"Unlock network", func(s *RestoreStats) *time.Duration { return &s.NetworkUnlock }},
+	{"Restore finished successfully", func(s *RestoreStats) *time.Duration { return &s.RestoreFinished }},
+	{"Writing stats", func(s *RestoreStats) *time.Duration { return &s.WritingStats }},
+}
+
+// Phases returns the restore phases in the order in which they happen, with the time
+// spent to reach each one from the previous phase, so that they add up to the total restore time
+func (s RestoreStats) Phases() []RestorePhase {
+	offsets := []RestorePhase{
+		{Name: "fork", Duration: s.Fork},
+		{Name: "memory_restore", Duration: s.MemoryRestore},
+		{Name: "network_unlock", Duration: s.NetworkUnlock},
+		{Name: "restore_finished", Duration: s.RestoreFinished},
+		{Name: "writing_stats", Duration: s.WritingStats},
+	}
+
+	phases := make([]RestorePhase, 0, len(offsets))
+	var previous time.Duration
+	for _, offset := range offsets {
+		duration := offset.Duration - previous
+		if duration < 0 {
+			// A phase missing from the log has no offset
+			duration = 0
+		}
+		phases = append(phases, RestorePhase{Name: offset.Name, Duration: duration})
+		if offset.Duration > previous {
+			previous = offset.Duration
+		}
+	}
+	return phases
+}
+
+// ParseRestoreLog reads a criu restore log and records the first occurrence of each phase.
+// An error is returned when the log does not reach the "Writing stats" phase.
+func ParseRestoreLog(r io.Reader) (RestoreStats, error) {
+	stats := RestoreStats{}
+	found := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		match := restoreLogLine.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+
+		for _, m := range restoreMarkers {
+			if found[m.marker] || !strings.HasPrefix(match[3], m.marker) {
+				continue
+			}
+
+			timestamp, err := parseRestoreTimestamp(match[1], match[2])
+			if err != nil {
+				return stats, err
+			}
+
+			*m.field(&stats) = timestamp
+			found[m.marker] = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return stats, err
+	}
+
+	if !found["Writing stats"] {
+		return stats, fmt.Errorf("restore log is incomplete, no \"Writing stats\" line found")
+	}
+
+	return stats, nil
+}
+
+// ReadRestoreStats parses the criu restore log found at path
+func ReadRestoreStats(path string) (RestoreStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return RestoreStats{}, err
+	}
+	defer f.Close()
+
+	return ParseRestoreLog(f)
+}
+
+func parseRestoreTimestamp(seconds string, micros string) (time.Duration, error) {
+	s, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	us, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(s)*time.Second + time.Duration(us)*time.Microsecond, nil
+}
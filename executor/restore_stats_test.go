@@ -0,0 +1,137 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const restoreLog = `(00.000000) Version: 3.12 (gitid 0)
+(00.004411) Forking task with 11 pid (flags 0x0)
+(00.004610) Forking task with 12 pid (flags 0x0)
+(00.019801) Restore via sigreturn
+(00.530077) pie: 18: 18: Restored
+(00.530269) Unlock network
+(00.532123) Restore finished successfully. Resuming tasks.
+(00.533888) Writing stats
+`
+
+func TestParseRestoreLog_AllPhases(t *testing.T) {
+	stats, err := ParseRestoreLog(strings.NewReader(restoreLog))
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err.Error())
+	}
+
+	want := RestoreStats{
+		Fork:            4411 * time.Microsecond,
+		MemoryRestore:   19801 * time.Microsecond,
+		NetworkUnlock:   530269 * time.Microsecond,
+		RestoreFinished: 532123 * time.Microsecond,
+		WritingStats:    533888 * time.Microsecond,
+	}
+
+	if stats != want {
+		t.Errorf("want: %+v, got: %+v", want, stats)
+	}
+}
+
+func TestRestoreStats_Phases(t *testing.T) {
+	stats, err := ParseRestoreLog(strings.NewReader(restoreLog))
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err.Error())
+	}
+
+	want := []RestorePhase{
+		{Name: "fork", Duration: 4411 * time.Microsecond},
+		{Name: "memory_restore", Duration: 15390 * time.Microsecond},
+		{Name: "network_unlock", Duration: 510468 * time.Microsecond},
+		{Name: "restore_finished", Duration: 1854 * time.Microsecond},
+		{Name: "writing_stats", Duration: 1765 * time.Microsecond},
+	}
+
+	var total time.Duration
+	for i, phase := range stats.Phases() {
+		if phase != want[i] {
+			t.Errorf("want: %+v, got: %+v", want[i], phase)
+		}
+		total += phase.Duration
+	}
+	if total != stats.WritingStats {
+		t.Errorf("want phases to add up to %s, got: %s", stats.WritingStats, total)
+	}
+}
+
+func TestParseRestoreLog_Incomplete(t *testing.T) {
+	_, err := ParseRestoreLog(strings.NewReader("(00.004411) Forking task with 11 pid (flags 0x0)\n"))
+	if err == nil {
+		t.Errorf("want an error for a log without \"Writing stats\"")
+	}
+}
+
+const TestFilepath = "/tmp/restore.log"
+
+func TestGetRestoreTime(t *testing.T) {
+	err := populate("(00.530269) Unlock network\n(00.532123) Restore finished successfully. Resuming tasks.\n(00.533888) Writing stats\n")
+	if err != nil {
+		t.Fatalf("Error when trying to write data to test file: %v", err.Error())
+	}
+	defer deleteFile()
+
+	stats, err := ReadRestoreStats(TestFilepath)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err.Error())
+	}
+
+	result := getStartupTime(true, &stats, "")
+	expected := int64(533888000)
+	if result != expected {
+		t.Errorf("Restore time is incorrect, got: %v, want: %v.", result, expected)
+	}
+}
+
+func TestGetStartupTime_UnmatchedRestoreLog(t *testing.T) {
+	err := populate("(00.530269) Unlock network\nnot a criu line\n")
+	if err != nil {
+		t.Fatalf("Error when trying to write data to test file: %v", err.Error())
+	}
+	defer deleteFile()
+
+	if _, err := ReadRestoreStats(TestFilepath); err == nil {
+		t.Fatalf("want an error for an incomplete restore log")
+	}
+
+	result := getStartupTime(true, nil, "")
+	if result != 0 {
+		t.Errorf("want: 0, got: %d", result)
+	}
+}
+
+func TestRestorePhaseHeader(t *testing.T) {
+	got := restorePhaseHeader("network_unlock")
+	want := "X-Restore-Network-Unlock-Time"
+	if got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func deleteFile() error {
+	return os.Remove(TestFilepath)
+}
+
+func populate(data string) error {
+	f, err := os.OpenFile(TestFilepath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error: cannot open tmp file for test %q", err.Error()))
+	}
+	if _, err := f.Write([]byte(data)); err != nil {
+		f.Close() // ignore error; Write error takes precedence
+		return errors.New(fmt.Sprintf("Error: cannot write data to tmp file used in the test %q", err.Error()))
+	}
+	if err := f.Close(); err != nil {
+		return errors.New(fmt.Sprintf("Error: cannot close tmp file used in the test %q", err.Error()))
+	}
+	return nil
+}
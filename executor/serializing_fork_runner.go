@@ -1,61 +1,168 @@
 package executor
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"os"
 	"os/exec"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/admission"
+	"github.com/paulofelipefeitosa/of-watchdog/logging"
+	"github.com/paulofelipefeitosa/of-watchdog/metrics"
+	"github.com/paulofelipefeitosa/of-watchdog/tracing"
 )
 
 // SerializingForkFunctionRunner forks a process for each invocation
 type SerializingForkFunctionRunner struct {
 	ExecTimeout time.Duration
+	Prefork     *PreforkPool // Prefork hands out warm processes instead of forking, optional
+
+	// CGIResponse parses a CGI header block printed by the function
+	// before the body, and applies it to the HTTP response
+	CGIResponse bool
+
+	// ExitCodeStatus maps a non-zero exit code to a HTTP status,
+	// unmapped exit codes give a 500
+	ExitCodeStatus map[int]int
+
+	// IncludeStderr writes the stderr of a failed function in the response body
+	IncludeStderr bool
+
+	// Resources records the CPU, memory and page faults of each process, optional
+	Resources *metrics.Resources
+}
+
+// ExitError is returned when the function exits with a non-zero status
+type ExitError struct {
+	ExitCode int
+	Stderr   []byte
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("function exited with code %d", e.ExitCode)
+}
+
+// TimeoutError is returned when the function was killed by ExecTimeout
+type TimeoutError struct {
+	ExecTimeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("function was killed after exec_timeout of %s", e.ExecTimeout)
+}
+
+// statusFor returns the HTTP status for a non-zero exit code
+func (f *SerializingForkFunctionRunner) statusFor(exitCode int) int {
+	if status, ok := f.ExitCodeStatus[exitCode]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
 }
 
 // Run run a fork for each invocation
 func (f *SerializingForkFunctionRunner) Run(req FunctionRequest, w http.ResponseWriter) error {
 	start := time.Now()
 	functionBytes, err := serializeFunction(req, f)
+	if timeoutErr, ok := err.(*TimeoutError); ok {
+		w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(start).Seconds()))
+		w.WriteHeader(http.StatusGatewayTimeout)
+		w.Write([]byte(timeoutErr.Error()))
+		return err
+	}
+
+	if exitErr, ok := err.(*ExitError); ok {
+		w.Header().Set("X-Exit-Code", strconv.Itoa(exitErr.ExitCode))
+		w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(start).Seconds()))
+		w.WriteHeader(f.statusFor(exitErr.ExitCode))
+
+		if f.IncludeStderr {
+			w.Write(exitErr.Stderr)
+		} else {
+			w.Write([]byte(exitErr.Error()))
+		}
+		return err
+	}
+
 	if err != nil {
+		status := http.StatusInternalServerError
+		if admission.IsTooLarge(err) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
 		w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(start).Seconds()))
-		w.WriteHeader(500)
+		w.WriteHeader(status)
 		w.Write([]byte(err.Error()))
 		return err
 	}
+
+	w.Header().Set("X-Exit-Code", "0")
+	status := http.StatusOK
+	if f.CGIResponse && functionBytes != nil {
+		cgiStatus, header, body, cgiErr := parseCGIResponse(*functionBytes)
+		if cgiErr != nil {
+			w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(start).Seconds()))
+			w.WriteHeader(500)
+			w.Write([]byte(cgiErr.Error()))
+			return cgiErr
+		}
+
+		copyHeaders(w.Header(), &header)
+		status = cgiStatus
+		functionBytes = &body
+	}
+
 	w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(start).Seconds()))
-	w.WriteHeader(200)
+	w.WriteHeader(status)
 
 	if functionBytes != nil {
 		_, err = w.Write(*functionBytes)
 	} else {
-		log.Println("Empty function response.")
+		logging.FromContext(req.Context).Info("Empty function response.")
 	}
 
 	return err
 }
 
 func serializeFunction(req FunctionRequest, f *SerializingForkFunctionRunner) (*[]byte, error) {
-	log.Printf("Running %s", req.Process)
+	logger := logging.FromContext(req.Context)
+	logger.Info(fmt.Sprintf("Running %s", req.Process))
 
 	start := time.Now()
-	cmd := exec.Command(req.Process, req.ProcessArgs...)
-	cmd.Env = req.Environment
+
+	ctx, span := startExecSpan(req)
+	defer span.Finish()
+
+	var preforked *PreforkedProcess
+	var cmd *exec.Cmd
+	if f.Prefork != nil {
+		span.SetAttribute("process.preforked", "true")
+		preforked = f.Prefork.Get()
+		cmd = preforked.Cmd
+	} else {
+		cmd = exec.Command(req.Process, req.ProcessArgs...)
+		cmd.Env = traceEnvironment(req.Environment, span)
+	}
 
 	var timer *time.Timer
+	var timedOut int32
 	if f.ExecTimeout > time.Millisecond*0 {
 
 		timer = time.NewTimer(f.ExecTimeout)
 		go func() {
 			<-timer.C
 
-			log.Printf("Function was killed by ExecTimeout: %s\n", f.ExecTimeout.String())
+			atomic.StoreInt32(&timedOut, 1)
+			logger.Warn(fmt.Sprintf("Function was killed by ExecTimeout: %s", f.ExecTimeout.String()))
 			killErr := cmd.Process.Kill()
 			if killErr != nil {
-				log.Println("Error killing function due to ExecTimeout", killErr)
+				logger.Error(fmt.Sprintf("Error killing function due to ExecTimeout: %s", killErr))
 			}
 		}()
 	}
@@ -74,32 +181,80 @@ func serializeFunction(req FunctionRequest, f *SerializingForkFunctionRunner) (*
 		data, err = ioutil.ReadAll(limitReader)
 
 		if err != nil {
+			if preforked != nil {
+				preforked.Stderr.Close()
+				cmd.Process.Kill()
+				cmd.Wait()
+			}
 			return nil, err
 		}
 
 	}
 
-	stdout, _ := cmd.StdoutPipe()
-	stdin, _ := cmd.StdinPipe()
+	var stdout io.Reader
+	var stdin io.WriteCloser
+	var errPipe io.Reader
+	var err error
 
-	err := cmd.Start()
-	if err != nil {
-		return nil, err
+	if preforked != nil {
+		stdout = preforked.Stdout
+		stdin = preforked.Stdin
+		errPipe = preforked.Stderr
+	} else {
+		stdout, _ = cmd.StdoutPipe()
+		stdin, _ = cmd.StdinPipe()
+		errPipe, _ = cmd.StderrPipe()
+
+		_, forkSpan := tracing.StartSpan(ctx, "fork", tracing.KindInternal)
+		err = cmd.Start()
+		forkSpan.Finish()
+		if err != nil {
+			span.SetError()
+			return nil, err
+		}
 	}
 
+	// stderr is logged and captured for the error response
+	var stderr bytes.Buffer
+	stderrDone := bindLoggingPipe("stderr", io.TeeReader(errPipe, &stderr), os.Stderr, logging.CallID(req.Context))
+
 	functionRes, errors := pipeToProcess(stdin, stdout, &data)
 
+	<-stderrDone
+
+	waitErr := cmd.Wait()
+	finishExecSpan(span, waitErr)
+	processStart := metrics.StartCold
+	if preforked != nil {
+		processStart = metrics.StartPreforked
+	}
+	observeUsage(f.Resources, cmd.ProcessState, processStart)
+
+	// The killed process exits with -1, which is not an exit code of the function
+	if atomic.LoadInt32(&timedOut) == 1 {
+		span.SetError()
+		return nil, &TimeoutError{ExecTimeout: f.ExecTimeout}
+	}
+
+	// A function which exits without reading its input breaks the pipe, its exit code is what matters
+	if exitErr, ok := waitErr.(*exec.ExitError); ok {
+		return functionRes, &ExitError{
+			ExitCode: exitErr.ExitCode(),
+			Stderr:   stderr.Bytes(),
+		}
+	}
+
 	if len(errors) > 0 {
+		span.SetError()
 		return nil, errors[0]
 	}
 
-	waitErr := cmd.Wait()
 	if waitErr != nil {
-		return nil, err
+		return nil, waitErr
 	}
 
 	done := time.Since(start)
-	log.Printf("Took %f secs", done.Seconds())
+	logger.Info(fmt.Sprintf("Took %f secs", done.Seconds()))
 
 	return functionRes, nil
 }
@@ -108,14 +263,8 @@ func pipeToProcess(stdin io.WriteCloser, stdout io.Reader, data *[]byte) (*[]byt
 	var functionResult *[]byte
 	var errors []error
 
-	errChannel := make(chan error)
-
-	go func() {
-		for goErr := range errChannel {
-			errors = append(errors, goErr)
-		}
-		close(errChannel)
-	}()
+	// Buffered for both goroutines, the errors are collected once they are done
+	errChannel := make(chan error, 2)
 
 	wg := sync.WaitGroup{}
 	wg.Add(2)
@@ -143,6 +292,11 @@ func pipeToProcess(stdin io.WriteCloser, stdout io.Reader, data *[]byte) (*[]byt
 	}(errChannel)
 
 	wg.Wait()
+	close(errChannel)
+
+	for goErr := range errChannel {
+		errors = append(errors, goErr)
+	}
 
 	return functionResult, errors
 }
@@ -0,0 +1,126 @@
+package executor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runSerializing(t *testing.T, f *SerializingForkFunctionRunner, script string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	contentLength := int64(0)
+
+	f.Run(FunctionRequest{
+		Process:       "sh",
+		ProcessArgs:   []string{"-c", script},
+		InputReader:   ioutil.NopCloser(strings.NewReader("")),
+		ContentLength: &contentLength,
+	}, rr)
+
+	return rr
+}
+
+func TestSerializingForkFunctionRunner_ExitCodes(t *testing.T) {
+	cases := []struct {
+		name         string
+		script       string
+		includeErr   bool
+		wantStatus   int
+		wantExitCode string
+		wantBody     string
+	}{
+		{
+			name:         "success",
+			script:       "echo -n ok",
+			wantStatus:   http.StatusOK,
+			wantExitCode: "0",
+			wantBody:     "ok",
+		},
+		{
+			name:         "mapped exit code",
+			script:       "echo -n partial; exit 2",
+			wantStatus:   http.StatusBadRequest,
+			wantExitCode: "2",
+			wantBody:     "function exited with code 2",
+		},
+		{
+			name:         "unmapped exit code",
+			script:       "exit 3",
+			wantStatus:   http.StatusInternalServerError,
+			wantExitCode: "3",
+			wantBody:     "function exited with code 3",
+		},
+		{
+			name:         "stderr in body",
+			script:       "echo invalid input >&2; exit 2",
+			includeErr:   true,
+			wantStatus:   http.StatusBadRequest,
+			wantExitCode: "2",
+			wantBody:     "invalid input\n",
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			f := &SerializingForkFunctionRunner{
+				ExitCodeStatus: map[int]int{2: http.StatusBadRequest},
+				IncludeStderr:  testCase.includeErr,
+			}
+
+			rr := runSerializing(t, f, testCase.script)
+
+			if rr.Code != testCase.wantStatus {
+				t.Errorf("status want: %d, got: %d", testCase.wantStatus, rr.Code)
+			}
+			if got := rr.Header().Get("X-Exit-Code"); got != testCase.wantExitCode {
+				t.Errorf("X-Exit-Code want: %s, got: %s", testCase.wantExitCode, got)
+			}
+			if rr.Body.String() != testCase.wantBody {
+				t.Errorf("body want: %q, got: %q", testCase.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestSerializingForkFunctionRunner_ExecTimeout(t *testing.T) {
+	f := &SerializingForkFunctionRunner{
+		ExecTimeout: time.Millisecond * 100,
+	}
+
+	rr := runSerializing(t, f, "exec sleep 5")
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("status want: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if want := "function was killed after exec_timeout of 100ms"; rr.Body.String() != want {
+		t.Errorf("body want: %q, got: %q", want, rr.Body.String())
+	}
+}
+
+func TestSerializingForkFunctionRunner_ExitWithoutReadingInput(t *testing.T) {
+	f := &SerializingForkFunctionRunner{
+		ExitCodeStatus: map[int]int{2: http.StatusBadRequest},
+	}
+
+	// The input is larger than a pipe buffer, so writing it fails once the function has exited
+	input := strings.Repeat("x", 1<<20)
+	contentLength := int64(len(input))
+
+	rr := httptest.NewRecorder()
+	f.Run(FunctionRequest{
+		Process:       "sh",
+		ProcessArgs:   []string{"-c", "exit 2"},
+		InputReader:   ioutil.NopCloser(strings.NewReader(input)),
+		ContentLength: &contentLength,
+	}, rr)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status want: %d, got: %d", http.StatusBadRequest, rr.Code)
+	}
+	if got := rr.Header().Get("X-Exit-Code"); got != "2" {
+		t.Errorf("X-Exit-Code want: %s, got: %s", "2", got)
+	}
+}
@@ -1,12 +1,16 @@
 package executor
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/exec"
 	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/logging"
+	"github.com/paulofelipefeitosa/of-watchdog/metrics"
+	"github.com/paulofelipefeitosa/of-watchdog/tracing"
 )
 
 // FunctionRunner runs a function
@@ -23,19 +27,46 @@ type FunctionRequest struct {
 	InputReader   io.ReadCloser
 	OutputWriter  io.Writer
 	ContentLength *int64
+
+	Context context.Context // Context carries the trace of the call, optional
+}
+
+// ExitCode returns the exit code of the function from the error returned by Run,
+// 0 for no error and -1 when the function did not exit normally.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
 }
 
 // ForkFunctionRunner forks a process for each invocation
 type ForkFunctionRunner struct {
 	ExecTimeout time.Duration
+	Prefork     *PreforkPool // Prefork hands out warm processes instead of forking, optional
+
+	// Resources records the CPU, memory and page faults of each process, optional
+	Resources *metrics.Resources
 }
 
 // Run run a fork for each invocation
 func (f *ForkFunctionRunner) Run(req FunctionRequest) error {
-	log.Printf("Running %s", req.Process)
+	if f.Prefork != nil {
+		return f.runPreforked(req)
+	}
+
+	logger := logging.FromContext(req.Context)
+	logger.Info(fmt.Sprintf("Running %s", req.Process))
 	start := time.Now()
+
+	ctx, span := startExecSpan(req)
+	defer span.Finish()
+
 	cmd := exec.Command(req.Process, req.ProcessArgs...)
-	cmd.Env = req.Environment
+	cmd.Env = traceEnvironment(req.Environment, span)
 
 	var timer *time.Timer
 	if f.ExecTimeout > time.Millisecond*0 {
@@ -44,7 +75,7 @@ func (f *ForkFunctionRunner) Run(req FunctionRequest) error {
 		go func() {
 			<-timer.C
 
-			log.Printf("Function was killed by ExecTimeout: %s\n", f.ExecTimeout.String())
+			logger.Warn(fmt.Sprintf("Function was killed by ExecTimeout: %s", f.ExecTimeout.String()))
 			killErr := cmd.Process.Kill()
 			if killErr != nil {
 				fmt.Println("Error killing function due to ExecTimeout", killErr)
@@ -66,17 +97,22 @@ func (f *ForkFunctionRunner) Run(req FunctionRequest) error {
 	errPipe, _ := cmd.StderrPipe()
 
 	// Prints stderr to console and is picked up by container logging driver.
-	bindLoggingPipe("stderr", errPipe, os.Stderr)
+	bindLoggingPipe("stderr", errPipe, os.Stderr, logging.CallID(req.Context))
 
+	_, forkSpan := tracing.StartSpan(ctx, "fork", tracing.KindInternal)
 	startErr := cmd.Start()
+	forkSpan.Finish()
 
 	if startErr != nil {
+		span.SetError()
 		return startErr
 	}
 
 	waitErr := cmd.Wait()
+	finishExecSpan(span, waitErr)
 	done := time.Since(start)
-	log.Printf("Took %f secs", done.Seconds())
+	logger.Info(fmt.Sprintf("Took %f secs", done.Seconds()))
+	observeUsage(f.Resources, cmd.ProcessState, metrics.StartCold)
 	if timer != nil {
 		timer.Stop()
 	}
@@ -89,3 +125,53 @@ func (f *ForkFunctionRunner) Run(req FunctionRequest) error {
 
 	return nil
 }
+
+// runPreforked streams the request through a warm process from the prefork pool
+func (f *ForkFunctionRunner) runPreforked(req FunctionRequest) error {
+	logger := logging.FromContext(req.Context)
+	logger.Info(fmt.Sprintf("Running preforked %s", req.Process))
+	start := time.Now()
+	_, span := startExecSpan(req)
+	span.SetAttribute("process.preforked", "true")
+	defer span.Finish()
+
+	process := f.Prefork.Get()
+	cmd := process.Cmd
+
+	// Prints stderr to console and is picked up by container logging driver.
+	stderrDone := bindLoggingPipe("stderr", process.Stderr, os.Stderr, logging.CallID(req.Context))
+
+	var timer *time.Timer
+	if f.ExecTimeout > time.Millisecond*0 {
+		timer = time.AfterFunc(f.ExecTimeout, func() {
+			logger.Warn(fmt.Sprintf("Function was killed by ExecTimeout: %s", f.ExecTimeout.String()))
+			if killErr := cmd.Process.Kill(); killErr != nil {
+				logger.Error(fmt.Sprintf("Error killing function due to ExecTimeout: %s", killErr))
+			}
+		})
+		defer timer.Stop()
+	}
+
+	go func() {
+		if req.InputReader != nil {
+			defer req.InputReader.Close()
+			io.Copy(process.Stdin, req.InputReader)
+		}
+		process.Stdin.Close()
+	}()
+
+	_, copyErr := io.Copy(req.OutputWriter, process.Stdout)
+	<-stderrDone
+
+	waitErr := cmd.Wait()
+	finishExecSpan(span, waitErr)
+	done := time.Since(start)
+	logger.Info(fmt.Sprintf("Took %f secs", done.Seconds()))
+	observeUsage(f.Resources, cmd.ProcessState, metrics.StartPreforked)
+
+	if waitErr != nil {
+		return waitErr
+	}
+
+	return copyErr
+}
@@ -0,0 +1,201 @@
+package executor
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// RestartNever leaves the function down once it exits, the watchdog exits if it failed
+	RestartNever = "never"
+
+	// RestartOnFailure restarts the function when it exits with a non-zero status
+	RestartOnFailure = "on-failure"
+
+	// RestartAlways restarts the function whenever it exits
+	RestartAlways = "always"
+)
+
+// Supervisor waits on a long-running function process and restarts it according to Policy
+type Supervisor struct {
+	Policy      string        // Policy is one of RestartNever, RestartOnFailure or RestartAlways
+	Backoff     time.Duration // Backoff before the first restart, doubled for each consecutive restart
+	MaxBackoff  time.Duration // MaxBackoff caps the backoff, a process which runs for longer is considered stable
+	MaxRestarts int           // MaxRestarts in a row before the watchdog exits, 0 for no limit
+
+	// OnHealthChange is called with false when the function exits and with true once it was restarted
+	OnHealthChange func(healthy bool)
+
+	// Ready blocks until a restarted process can serve, i.e. with a readiness probe, optional.
+	// The function stays unhealthy when it returns an error.
+	Ready func() error
+
+	mutex    sync.Mutex
+	process  *os.Process
+	stopping bool
+	forced   bool // forced is set when the process was killed by Restart
+}
+
+// Restart kills process so that it is re-forked straight away regardless of Policy.
+// It has no effect if process has already been replaced.
+func (s *Supervisor) Restart(process *os.Process) error {
+	s.mutex.Lock()
+	if s.process != process {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.forced = true
+	s.mutex.Unlock()
+
+	// Marked unhealthy before the kill so that no request is sent to the process meanwhile
+	s.setHealthy(false)
+	return process.Kill()
+}
+
+// Process returns the function process currently supervised
+func (s *Supervisor) Process() *os.Process {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.process
+}
+
+// Stop sends SIGTERM to the function process, which will not be restarted
+func (s *Supervisor) Stop() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stopping = true
+	return s.process.Signal(syscall.SIGTERM)
+}
+
+// Supervise forwards SIGTERM to the function process and restarts it with start when it exits
+func (s *Supervisor) Supervise(process *os.Process, start func() (*os.Process, error)) {
+	s.mutex.Lock()
+	s.process = process
+	s.mutex.Unlock()
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM)
+
+		<-sig
+		s.Stop()
+	}()
+
+	go s.watch(process, start)
+}
+
+func (s *Supervisor) watch(process *os.Process, start func() (*os.Process, error)) {
+	restarts := 0
+
+	for {
+		startedTime := time.Now()
+		state, err := process.Wait()
+		if err != nil {
+			log.Printf("Unable to wait for forked function: %s", err.Error())
+			return
+		}
+
+		s.mutex.Lock()
+		stopping := s.stopping
+		forced := s.forced
+		s.forced = false
+		s.mutex.Unlock()
+		if stopping {
+			return
+		}
+
+		// A forced restart was already marked unhealthy by Restart
+		if forced {
+			log.Printf("Forked function was killed, restarting")
+			if process, err = s.restart(start); err != nil {
+				log.Fatalf("Unable to restart forked function: %s", err.Error())
+			}
+			continue
+		}
+
+		s.setHealthy(false)
+
+		if !s.shouldRestart(state) {
+			if !state.Success() {
+				log.Fatalf("Forked function has terminated: %s", state.String())
+			}
+			log.Printf("Forked function has exited: %s", state.String())
+			return
+		}
+
+		// A process which stayed up for longer than the maximum backoff resets the crash-loop count
+		if time.Since(startedTime) > s.MaxBackoff {
+			restarts = 0
+		}
+
+		if s.MaxRestarts > 0 && restarts >= s.MaxRestarts {
+			log.Fatalf("Forked function is crash-looping, gave up after %d restarts: %s", restarts, state.String())
+		}
+
+		backoff := s.backoff(restarts)
+		restarts++
+
+		log.Printf("Forked function has terminated: %s, restarting in %s (restart %d)", state.String(), backoff, restarts)
+		time.Sleep(backoff)
+
+		if process, err = s.restart(start); err != nil {
+			log.Fatalf("Unable to restart forked function: %s", err.Error())
+		}
+	}
+}
+
+func (s *Supervisor) restart(start func() (*os.Process, error)) (*os.Process, error) {
+	process, err := start()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.process = process
+	s.mutex.Unlock()
+
+	if s.Ready != nil {
+		if err := s.Ready(); err != nil {
+			log.Printf("Restarted function is not ready: %s", err.Error())
+			return process, nil
+		}
+	}
+
+	s.setHealthy(true)
+	return process, nil
+}
+
+func (s *Supervisor) shouldRestart(state *os.ProcessState) bool {
+	switch s.Policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return !state.Success()
+	default:
+		return false
+	}
+}
+
+// backoff doubles Backoff for each consecutive restart, up to MaxBackoff
+func (s *Supervisor) backoff(restarts int) time.Duration {
+	backoff := s.Backoff
+	for i := 0; i < restarts && backoff < s.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.MaxBackoff {
+		backoff = s.MaxBackoff
+	}
+	return backoff
+}
+
+func (s *Supervisor) setHealthy(healthy bool) {
+	if s.OnHealthChange != nil {
+		s.OnHealthChange(healthy)
+	}
+}
@@ -0,0 +1,197 @@
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startCommand(t *testing.T, name string, args ...string) *os.Process {
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process
+}
+
+func TestSupervisor_RestartsUntilStable(t *testing.T) {
+	var mutex sync.Mutex
+	var health []bool
+	restarted := make(chan *os.Process, 1)
+
+	s := Supervisor{
+		Policy:      RestartAlways,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  time.Millisecond * 10,
+		MaxRestarts: 5,
+		OnHealthChange: func(healthy bool) {
+			mutex.Lock()
+			health = append(health, healthy)
+			mutex.Unlock()
+		},
+	}
+
+	starts := 0
+	s.Supervise(startCommand(t, "true"), func() (*os.Process, error) {
+		starts++
+		if starts < 2 {
+			return startCommand(t, "true"), nil
+		}
+
+		process := startCommand(t, "sleep", "5")
+		restarted <- process
+		return process, nil
+	})
+
+	select {
+	case <-restarted:
+	case <-time.After(time.Second * 2):
+		t.Fatalf("function was not restarted")
+	}
+	defer s.Stop()
+
+	// Allow the health change after the last restart to be recorded
+	time.Sleep(time.Millisecond * 50)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	want := []bool{false, true, false, true}
+	if len(health) != len(want) {
+		t.Fatalf("health changes want: %v, got: %v", want, health)
+	}
+	for i := range want {
+		if health[i] != want[i] {
+			t.Errorf("health changes want: %v, got: %v", want, health)
+		}
+	}
+}
+
+func TestSupervisor_ShouldRestart(t *testing.T) {
+	success := startCommand(t, "true")
+	successState, _ := success.Wait()
+	failure := startCommand(t, "false")
+	failureState, _ := failure.Wait()
+
+	cases := []struct {
+		policy  string
+		state   *os.ProcessState
+		restart bool
+	}{
+		{RestartNever, failureState, false},
+		{RestartNever, successState, false},
+		{RestartOnFailure, failureState, true},
+		{RestartOnFailure, successState, false},
+		{RestartAlways, failureState, true},
+		{RestartAlways, successState, true},
+	}
+
+	for _, testCase := range cases {
+		s := Supervisor{Policy: testCase.policy}
+		if got := s.shouldRestart(testCase.state); got != testCase.restart {
+			t.Errorf("(%s, %s) want restart: %v, got: %v", testCase.policy, testCase.state, testCase.restart, got)
+		}
+	}
+}
+
+func TestSupervisor_Backoff(t *testing.T) {
+	s := Supervisor{
+		Backoff:    time.Second,
+		MaxBackoff: time.Second * 5,
+	}
+
+	want := []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5}
+	for restarts, wantBackoff := range want {
+		if got := s.backoff(restarts); got != wantBackoff {
+			t.Errorf("backoff after %d restarts want: %s, got: %s", restarts, wantBackoff, got)
+		}
+	}
+}
+
+func TestSupervisor_RestartMarksUnhealthyBeforeKill(t *testing.T) {
+	var mutex sync.Mutex
+	var health []bool
+	restarted := make(chan *os.Process, 1)
+
+	s := Supervisor{
+		Policy: RestartNever,
+		OnHealthChange: func(healthy bool) {
+			mutex.Lock()
+			health = append(health, healthy)
+			mutex.Unlock()
+		},
+	}
+
+	process := startCommand(t, "sleep", "5")
+	s.Supervise(process, func() (*os.Process, error) {
+		replacement := startCommand(t, "sleep", "5")
+		restarted <- replacement
+		return replacement, nil
+	})
+
+	if err := s.Restart(process); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	unhealthy := len(health) == 1 && health[0] == false
+	mutex.Unlock()
+	if !unhealthy {
+		t.Errorf("want the worker marked unhealthy when Restart returns, got: %v", health)
+	}
+
+	select {
+	case <-restarted:
+	case <-time.After(time.Second * 2):
+		t.Fatalf("function was not restarted")
+	}
+	defer s.Stop()
+
+	time.Sleep(time.Millisecond * 50)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if want := []bool{false, true}; len(health) != 2 || health[0] != want[0] || health[1] != want[1] {
+		t.Errorf("want health changes %v, got: %v", want, health)
+	}
+}
+
+func TestSupervisor_RestartWaitsUntilReady(t *testing.T) {
+	health := make(chan bool, 4)
+	ready := make(chan error)
+
+	s := Supervisor{
+		Policy:         RestartNever,
+		OnHealthChange: func(healthy bool) { health <- healthy },
+		Ready:          func() error { return <-ready },
+	}
+
+	process := startCommand(t, "sleep", "5")
+	s.Supervise(process, func() (*os.Process, error) {
+		return startCommand(t, "sleep", "5"), nil
+	})
+	defer s.Stop()
+
+	s.Restart(process)
+	if healthy := <-health; healthy {
+		t.Fatalf("want the worker marked unhealthy by Restart")
+	}
+
+	select {
+	case healthy := <-health:
+		t.Fatalf("want no health change before the restarted process is ready, got: %v", healthy)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	ready <- nil
+	select {
+	case healthy := <-health:
+		if !healthy {
+			t.Errorf("want the worker healthy once ready")
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("worker was not marked healthy once ready")
+	}
+}
@@ -0,0 +1,38 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/paulofelipefeitosa/of-watchdog/tracing"
+)
+
+// startExecSpan starts the span of a forked function process
+func startExecSpan(req FunctionRequest) (context.Context, *tracing.Span) {
+	ctx, span := tracing.StartSpan(req.Context, "exec", tracing.KindInternal)
+	span.SetAttribute("process.executable.name", req.Process)
+	return ctx, span
+}
+
+// finishExecSpan records the exit code of the process
+func finishExecSpan(span *tracing.Span, waitErr error) {
+	exitCode := ExitCode(waitErr)
+	span.SetAttribute("process.exit.code", strconv.Itoa(exitCode))
+	if exitCode != 0 {
+		span.SetError()
+	}
+}
+
+// traceEnvironment passes the traceparent of span to the process, so that its
+// own spans are children of span. A nil environment is the watchdog's own.
+func traceEnvironment(environment []string, span *tracing.Span) []string {
+	if span == nil {
+		return environment
+	}
+
+	if environment == nil {
+		environment = os.Environ()
+	}
+	return append(environment, tracing.TraceparentEnv+"="+span.Traceparent())
+}
@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/paulofelipefeitosa/of-watchdog/tracing"
+)
+
+type recordingExporter struct {
+	spans []*tracing.Span
+}
+
+func (e *recordingExporter) Export(span *tracing.Span) {
+	e.spans = append(e.spans, span)
+}
+
+func TestForkFunctionRunner_PassesTraceparent(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracing.SetExporter(exporter)
+	defer tracing.SetExporter(nil)
+
+	ctx, parent := tracing.StartSpan(context.Background(), "server", tracing.KindServer)
+
+	output := &bytes.Buffer{}
+	f := &ForkFunctionRunner{}
+	err := f.Run(FunctionRequest{
+		Process:      "sh",
+		ProcessArgs:  []string{"-c", "echo $TRACEPARENT"},
+		InputReader:  ioutil.NopCloser(strings.NewReader("")),
+		OutputWriter: output,
+		Context:      ctx,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("want fork and exec spans, got: %d", len(exporter.spans))
+	}
+
+	exec := exporter.spans[1]
+	if exec.Name != "exec" || exec.Parent != parent.Context.SpanID {
+		t.Errorf("want exec span as a child of the server span, got: %s", exec.Name)
+	}
+
+	if got := strings.TrimSpace(output.String()); got != exec.Traceparent() {
+		t.Errorf("want TRACEPARENT %q, got: %q", exec.Traceparent(), got)
+	}
+}
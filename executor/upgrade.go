@@ -0,0 +1,146 @@
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/logging"
+)
+
+// isUpgrade returns true for requests such as WebSockets which ask to switch protocol
+func isUpgrade(r *http.Request) bool {
+	if len(r.Header.Get("Upgrade")) == 0 {
+		return false
+	}
+
+	for _, value := range r.Header["Connection"] {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proxyUpgrade forwards an upgrade request to the upstream and, once the upstream has
+// switched protocols, splices the client connection to the upstream connection in both directions.
+func (f *HTTPFunctionRunner) proxyUpgrade(r *http.Request, w http.ResponseWriter) error {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return fmt.Errorf("upgrade requires a connection which can be hijacked")
+	}
+
+	network, address := upstreamAddress(f.UpstreamURL)
+	upstreamConn, err := net.DialTimeout(network, address, f.ExecTimeout)
+	if err != nil {
+		logging.FromContext(r.Context()).Error(fmt.Sprintf("Upstream upgrade dial error: %s", err.Error()))
+		w.WriteHeader(http.StatusBadGateway)
+		return nil
+	}
+	defer upstreamConn.Close()
+
+	upstreamReq, _ := http.NewRequest(r.Method, upstreamHTTPURL(f.UpstreamURL).String()+r.RequestURI, nil)
+	copyHeaders(upstreamReq.Header, &r.Header)
+	f.Headers.Apply(upstreamReq.Header)
+	upstreamReq.Header.Set("Connection", "Upgrade")
+	upstreamReq.Header.Set("Upgrade", r.Header.Get("Upgrade"))
+	upstreamReq.Host = r.Host
+
+	if err := upstreamReq.Write(upstreamConn); err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return nil
+	}
+
+	upstreamReader := bufio.NewReader(upstreamConn)
+	res, err := http.ReadResponse(upstreamReader, upstreamReq)
+	if err != nil {
+		logging.FromContext(r.Context()).Error(fmt.Sprintf("Upstream upgrade response error: %s", err.Error()))
+		w.WriteHeader(http.StatusBadGateway)
+		return nil
+	}
+
+	// The upstream refused to switch protocols, relay its response as-is
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		defer res.Body.Close()
+
+		copyHeaders(w.Header(), &res.Header)
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+		return nil
+	}
+
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		return err
+	}
+	defer clientConn.Close()
+
+	// Deadlines set by the http.Server no longer apply to a hijacked connection
+	clientConn.SetDeadline(time.Time{})
+
+	if err := res.Write(clientConn); err != nil {
+		return err
+	}
+
+	logging.FromContext(r.Context()).Info(fmt.Sprintf("%s %s - %s - upgraded to %s", r.Method, r.RequestURI, res.Status, res.Header.Get("Upgrade")))
+
+	if f.UpgradeIdleTimeout <= 0 && f.ExecTimeout > 0 {
+		deadline := time.Now().Add(f.ExecTimeout)
+		clientConn.SetDeadline(deadline)
+		upstreamConn.SetDeadline(deadline)
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		f.splice(upstreamConn, clientBuf.Reader, clientConn, upstreamConn)
+	}()
+
+	go func() {
+		defer wg.Done()
+		f.splice(clientConn, upstreamReader, upstreamConn, clientConn)
+	}()
+
+	wg.Wait()
+
+	return nil
+}
+
+// splice copies from src, which buffers srcConn, to dst until either side is closed.
+// With UpgradeIdleTimeout set, both connections are closed once no data has been
+// read for that long.
+func (f *HTTPFunctionRunner) splice(dst net.Conn, src io.Reader, srcConn net.Conn, dstConn net.Conn) {
+	buf := make([]byte, 32*1024)
+	for {
+		if f.UpgradeIdleTimeout > 0 {
+			srcConn.SetReadDeadline(time.Now().Add(f.UpgradeIdleTimeout))
+		}
+
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			if f.UpgradeIdleTimeout > 0 {
+				dst.SetWriteDeadline(time.Now().Add(f.UpgradeIdleTimeout))
+			}
+			if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+				break
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	// Unblock the copy in the other direction
+	srcConn.Close()
+	dstConn.Close()
+}
@@ -0,0 +1,131 @@
+package executor
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoUpgradeServer switches protocol and echoes everything it reads
+func echoUpgradeServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+		io.Copy(conn, buf)
+	}))
+}
+
+func makeUpgradeWatchdog(t *testing.T, f *HTTPFunctionRunner, upgrade string) (net.Conn, *bufio.Reader, *http.Response, func()) {
+	watchdog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.Run(FunctionRequest{}, r.ContentLength, r, w)
+	}))
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(watchdog.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: watchdog\r\nConnection: Upgrade\r\nUpgrade: " + upgrade + "\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, reader, res, func() {
+		conn.Close()
+		watchdog.Close()
+	}
+}
+
+func TestIsUpgrade(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if isUpgrade(r) {
+		t.Errorf("want plain request not to be an upgrade")
+	}
+
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	if !isUpgrade(r) {
+		t.Errorf("want request with Connection: keep-alive, Upgrade to be an upgrade")
+	}
+}
+
+func TestHTTPFunctionRunner_UpgradeIsSpliced(t *testing.T) {
+	upstream := echoUpgradeServer()
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	f := &HTTPFunctionRunner{
+		ExecTimeout: time.Second * 5,
+		UpstreamURL: upstreamURL,
+	}
+
+	conn, reader, res, done := makeUpgradeWatchdog(t, f, "echo")
+	defer done()
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("want status %d, got: %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+
+	for _, message := range []string{"ping\n", "pong\n"} {
+		conn.Write([]byte(message))
+
+		line, err := reader.ReadString('\n')
+		if err != nil || line != message {
+			t.Errorf("want echo %q, got: %q, %v", message, line, err)
+		}
+	}
+}
+
+func TestHTTPFunctionRunner_UpgradeRefusedByUpstream(t *testing.T) {
+	upstream := echoUpgradeServer()
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	f := &HTTPFunctionRunner{
+		ExecTimeout: time.Second * 5,
+		UpstreamURL: upstreamURL,
+	}
+
+	_, _, res, done := makeUpgradeWatchdog(t, f, "websocket")
+	defer done()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("want status %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestHTTPFunctionRunner_UpgradeClosedWhenIdle(t *testing.T) {
+	upstream := echoUpgradeServer()
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	f := &HTTPFunctionRunner{
+		ExecTimeout:        time.Second * 5,
+		UpgradeIdleTimeout: time.Millisecond * 100,
+		UpstreamURL:        upstreamURL,
+	}
+
+	conn, reader, _, done := makeUpgradeWatchdog(t, f, "echo")
+	defer done()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("want idle connection to be closed, got: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"net/url"
+)
+
+// UnixSocketScheme is the scheme of an upstream listening on a Unix domain socket, i.e. unix:///tmp/function.sock
+const UnixSocketScheme = "unix"
+
+// upstreamAddress returns the network and address to dial for the upstream.
+// A URL without a port is dialed on the default port of its scheme, as the proxy client does.
+func upstreamAddress(upstreamURL *url.URL) (string, string) {
+	if upstreamURL.Scheme == UnixSocketScheme {
+		return "unix", upstreamURL.Path
+	}
+
+	if len(upstreamURL.Port()) > 0 {
+		return "tcp", upstreamURL.Host
+	}
+
+	port := "80"
+	if upstreamURL.Scheme == "https" {
+		port = "443"
+	}
+	return "tcp", net.JoinHostPort(upstreamURL.Hostname(), port)
+}
+
+// upstreamHTTPURL returns the URL which requests to the upstream are made against.
+// A socket has no host, so its requests are addressed to http://unix and dialed with dialUpstream.
+func upstreamHTTPURL(upstreamURL *url.URL) *url.URL {
+	if upstreamURL.Scheme == UnixSocketScheme {
+		return &url.URL{Scheme: "http", Host: UnixSocketScheme}
+	}
+	return upstreamURL
+}
+
+// dialUpstream returns a DialContext which connects to the upstream whatever address is requested
+func dialUpstream(dialer *net.Dialer, upstreamURL *url.URL) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if upstreamURL == nil || upstreamURL.Scheme != UnixSocketScheme {
+		return dialer.DialContext
+	}
+
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", upstreamURL.Path)
+	}
+}
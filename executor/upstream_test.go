@@ -0,0 +1,187 @@
+package executor
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// makeSocketUpstream serves handler on a Unix domain socket and returns its unix:// URL
+func makeSocketUpstream(t *testing.T, handler http.Handler) (*url.URL, func()) {
+	dir, err := ioutil.TempDir("", "upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "function.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(listener)
+
+	upstreamURL, _ := url.Parse("unix://" + socket)
+	return upstreamURL, func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestUpstreamAddress(t *testing.T) {
+	socketURL, _ := url.Parse("unix:///tmp/function.sock")
+	if network, address := upstreamAddress(socketURL); network != "unix" || address != "/tmp/function.sock" {
+		t.Errorf("want unix /tmp/function.sock, got: %s %s", network, address)
+	}
+
+	tcpURL, _ := url.Parse("http://127.0.0.1:5000")
+	if network, address := upstreamAddress(tcpURL); network != "tcp" || address != "127.0.0.1:5000" {
+		t.Errorf("want tcp 127.0.0.1:5000, got: %s %s", network, address)
+	}
+
+	defaults := map[string]string{
+		"http://127.0.0.1":  "127.0.0.1:80",
+		"https://localhost": "localhost:443",
+		"http://[::1]":      "[::1]:80",
+	}
+	for upstream, want := range defaults {
+		defaultURL, _ := url.Parse(upstream)
+		if network, address := upstreamAddress(defaultURL); network != "tcp" || address != want {
+			t.Errorf("(%s) want tcp %s, got: %s %s", upstream, want, network, address)
+		}
+	}
+}
+
+func TestHTTPFunctionRunner_UnixSocketUpstream(t *testing.T) {
+	upstreamURL, done := makeSocketUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("path: " + r.URL.Path))
+	}))
+	defer done()
+
+	f := &HTTPFunctionRunner{
+		Client:      makeProxyClient(time.Second, upstreamURL, false),
+		UpstreamURL: upstreamURL,
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/function", nil)
+	w := httptest.NewRecorder()
+
+	if err := f.Run(FunctionRequest{}, 0, r, w); err != nil {
+		t.Fatal(err)
+	}
+
+	if body := w.Body.String(); body != "path: /function" {
+		t.Errorf("want body %q, got: %q", "path: /function", body)
+	}
+}
+
+func TestReadinessProbe_UnixSocket(t *testing.T) {
+	upstreamURL, done := makeSocketUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_/ready" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer done()
+
+	for _, probeType := range []string{ProbeTCP, ProbeHTTP} {
+		probe := makeProbe(probeType, upstreamURL.String())
+		if err := probe.Probe(); err != nil {
+			t.Errorf("want %s probe of the socket to pass, got: %s", probeType, err.Error())
+		}
+	}
+}
+
+func TestHTTPFunctionRunner_H2CUpstreamTrailers(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte("message"))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	upstream.Config.Protocols = protocols
+	upstream.Start()
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	f := &HTTPFunctionRunner{
+		Client:      makeProxyClient(time.Second, upstreamURL, true),
+		UpstreamURL: upstreamURL,
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/service/Method", nil)
+	w := httptest.NewRecorder()
+
+	if err := f.Run(FunctionRequest{}, 0, r, w); err != nil {
+		t.Fatal(err)
+	}
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("want status %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	if status := res.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Errorf("want Grpc-Status trailer %q, got: %q", "0", status)
+	}
+}
+
+func TestHTTPFunctionRunner_FirstHealthyWithoutWarmup(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer upstream.Close()
+
+	firstHealthy := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "first_healthy_seconds"}, []string{"start"})
+	startup := &metrics.Startup{
+		ProcessStartSeconds:    prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "process_start_seconds"}, []string{"start"}),
+		FirstHealthySeconds:    firstHealthy,
+		FunctionStartupSeconds: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "function_seconds"}, []string{"start"}),
+	}
+	upstreamURL, _ := url.Parse(upstream.URL)
+	f := &HTTPFunctionRunner{
+		Process:        "true",
+		UpstreamURL:    upstreamURL,
+		StartupTime:    -1,
+		StartupMetrics: startup,
+	}
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 300)
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Fatalf("want the function not to be called before a request, got %d calls", n)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := f.Run(FunctionRequest{}, 0, r, httptest.NewRecorder()); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &dto.Metric{}
+	firstHealthy.WithLabelValues(metrics.StartCold).Write(m)
+	if m.Gauge.GetValue() <= 0 {
+		t.Errorf("want first healthy seconds recorded from the first response, got: %f", m.Gauge.GetValue())
+	}
+}
@@ -0,0 +1,205 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paulofelipefeitosa/of-watchdog/response"
+)
+
+const (
+	// AccessLogCommon is the Common Log Format, followed by the request bytes,
+	// total seconds and upstream seconds
+	AccessLogCommon = "common"
+
+	// AccessLogCombined adds the referer and user agent to AccessLogCommon
+	AccessLogCombined = "combined"
+
+	// AccessLogJSON writes one JSON object per request
+	AccessLogJSON = "json"
+)
+
+// clfTime is the timestamp layout of the Common Log Format
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLog writes one line for each request served by Handler. The time spent in
+// the function is only known when the function handler is wrapped with Upstream.
+type AccessLog struct {
+	Handler http.Handler
+	Format  string
+	Output  io.Writer
+
+	mutex  sync.Mutex
+	logger *slog.Logger
+}
+
+// NewAccessLog creates a handler which logs the requests to handler in format
+func NewAccessLog(handler http.Handler, format string, output io.Writer) (*AccessLog, error) {
+	switch format {
+	case AccessLogCommon, AccessLogCombined, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("unknown access_log: %q, want %s, %s or %s", format, AccessLogCommon, AccessLogCombined, AccessLogJSON)
+	}
+
+	return &AccessLog{
+		Handler: handler,
+		Format:  format,
+		Output:  output,
+		logger:  slog.New(slog.NewJSONHandler(output, nil)),
+	}, nil
+}
+
+// entry is the record of a request, completed by the handlers it passes through
+type entry struct {
+	mutex         sync.Mutex
+	upstreamStart time.Time
+	upstreamEnd   time.Time
+}
+
+type entryKey struct{}
+
+// Upstream records the time spent in next as the upstream time of the access log,
+// which excludes the time a request waits for a concurrency limiter.
+func Upstream(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, _ := r.Context().Value(entryKey{}).(*entry)
+		if e == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		e.mutex.Lock()
+		e.upstreamStart = time.Now()
+		e.mutex.Unlock()
+
+		defer func() {
+			e.mutex.Lock()
+			e.upstreamEnd = time.Now()
+			e.mutex.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// upstream returns the time spent in the function, and false if the request did not reach it
+func (e *entry) upstream() (time.Duration, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.upstreamStart.IsZero() || e.upstreamEnd.IsZero() {
+		return 0, false
+	}
+	return e.upstreamEnd.Sub(e.upstreamStart), true
+}
+
+func (a *AccessLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	e := &entry{}
+	body := &countingReader{ReadCloser: r.Body}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = body
+	}
+
+	aw := response.NewStatusWriter(w)
+	a.Handler.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), entryKey{}, e)))
+
+	duration := time.Since(start)
+	upstream, reached := e.upstream()
+
+	if a.Format == AccessLogJSON {
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", aw.Status,
+			"request_bytes", body.count(),
+			"response_bytes", aw.Bytes,
+			"duration_seconds", duration.Seconds(),
+			"client_ip", clientIP(r),
+		}
+		if reached {
+			attrs = append(attrs, "upstream_seconds", upstream.Seconds())
+		}
+		if callID := CallID(r.Context()); len(callID) > 0 {
+			attrs = append(attrs, "call_id", callID)
+		}
+		a.logger.Info("access", attrs...)
+		return
+	}
+
+	upstreamSeconds := "-"
+	if reached {
+		upstreamSeconds = fmt.Sprintf("%f", upstream.Seconds())
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		clientIP(r), dash(userName(r)), start.Format(clfTime),
+		r.Method, r.RequestURI, r.Proto, aw.Status, dash(strconv.FormatInt(aw.Bytes, 10)))
+
+	if a.Format == AccessLogCombined {
+		line += fmt.Sprintf(" %q %q", r.Referer(), r.UserAgent())
+	}
+
+	line += fmt.Sprintf(" %d %f %s\n", body.count(), duration.Seconds(), upstreamSeconds)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	io.WriteString(a.Output, line)
+}
+
+// clientIP is the first address of X-Forwarded-For, as set by the gateway, or the remote address
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); len(forwarded) > 0 {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func userName(r *http.Request) string {
+	user, _, _ := r.BasicAuth()
+	return user
+}
+
+// dash replaces an empty or zero field with "-", as in the Common Log Format
+func dash(field string) string {
+	if len(field) == 0 || field == "0" {
+		return "-"
+	}
+	return field
+}
+
+// countingReader counts the bytes of the request body read by the function
+type countingReader struct {
+	io.ReadCloser
+	mutex sync.Mutex
+	n     int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+
+	c.mutex.Lock()
+	c.n += int64(n)
+	c.mutex.Unlock()
+	return n, err
+}
+
+func (c *countingReader) count() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.n
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(body)
+	w.Write(body)
+}
+
+func Test_NewAccessLog_RejectsUnknownFormat(t *testing.T) {
+	if _, err := NewAccessLog(http.NotFoundHandler(), "apache", ioutil.Discard); err == nil {
+		t.Errorf("want an error for an unknown format")
+	}
+}
+
+func Test_AccessLog_Common(t *testing.T) {
+	var out bytes.Buffer
+	accessLog, _ := NewAccessLog(Upstream(http.HandlerFunc(echoHandler)), AccessLogCommon, &out)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders?id=1", strings.NewReader("hello"))
+	req.RemoteAddr = "10.0.0.1:51234"
+	accessLog.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := out.String()
+	if !strings.HasPrefix(line, "10.0.0.1 - - [") {
+		t.Errorf("want the client IP first, got: %q", line)
+	}
+	if !strings.Contains(line, `] "POST /orders?id=1 HTTP/1.1" 201 10 5 `) {
+		t.Errorf("want the request line, status, response and request bytes, got: %q", line)
+	}
+
+	fields := strings.Fields(line)
+	if upstream := fields[len(fields)-1]; upstream == "-" {
+		t.Errorf("want the upstream time, got: %q", line)
+	}
+}
+
+func Test_AccessLog_CombinedWithoutUpstream(t *testing.T) {
+	var out bytes.Buffer
+	rejected := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	accessLog, _ := NewAccessLog(rejected, AccessLogCombined, &out)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.Header.Set("X-Forwarded-For", "192.168.1.5, 10.0.0.1")
+	accessLog.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := strings.TrimSpace(out.String())
+	if !strings.HasPrefix(line, "192.168.1.5 ") {
+		t.Errorf("want the forwarded client IP, got: %q", line)
+	}
+	if !strings.Contains(line, `" 429 - "" "curl/8.0" 0 `) {
+		t.Errorf("want status, referer and user agent, got: %q", line)
+	}
+	if !strings.HasSuffix(line, " -") {
+		t.Errorf("want no upstream time when the function was not reached, got: %q", line)
+	}
+}
+
+func Test_AccessLog_JSON(t *testing.T) {
+	var out bytes.Buffer
+	accessLog, _ := NewAccessLog(Upstream(http.HandlerFunc(echoHandler)), AccessLogJSON, &out)
+
+	req := httptest.NewRequest(http.MethodPut, "/orders", strings.NewReader("hello"))
+	req.RemoteAddr = "10.0.0.1:51234"
+	Middleware(accessLog).ServeHTTP(httptest.NewRecorder(), req)
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("want a JSON line, got %q: %s", out.String(), err)
+	}
+
+	want := map[string]interface{}{
+		"method":         "PUT",
+		"path":           "/orders",
+		"status":         float64(201),
+		"request_bytes":  float64(5),
+		"response_bytes": float64(10),
+		"client_ip":      "10.0.0.1",
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s, want: %v, got: %v", key, value, line[key])
+		}
+	}
+
+	for _, key := range []string{"duration_seconds", "upstream_seconds", "call_id"} {
+		if _, ok := line[key]; !ok {
+			t.Errorf("want %s in %q", key, out.String())
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// CallIDHeader identifies a call in the logs of the watchdog and of the function
+const CallIDHeader = "X-Call-Id"
+
+type callIDKey struct{}
+
+// NewCallID generates a random call ID
+func NewCallID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// WithCallID returns a copy of ctx which carries the call ID
+func WithCallID(ctx context.Context, callID string) context.Context {
+	return context.WithValue(ctx, callIDKey{}, callID)
+}
+
+// CallID returns the call ID of ctx, or ""
+func CallID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	callID, _ := ctx.Value(callIDKey{}).(string)
+	return callID
+}
+
+// FromContext returns the default logger, with the call ID of ctx as call_id
+func FromContext(ctx context.Context) *slog.Logger {
+	if callID := CallID(ctx); len(callID) > 0 {
+		return slog.Default().With("call_id", callID)
+	}
+	return slog.Default()
+}
+
+// Middleware propagates the X-Call-Id of the request, or generates one, and echoes it in the response
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callID := r.Header.Get(CallIDHeader)
+		if len(callID) == 0 {
+			callID = NewCallID()
+			r.Header.Set(CallIDHeader, callID)
+		}
+
+		w.Header().Set(CallIDHeader, callID)
+		next.ServeHTTP(w, r.WithContext(WithCallID(r.Context(), callID)))
+	})
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	// FormatText writes the classic log lines of the watchdog, followed by key=value fields
+	FormatText = "text"
+
+	// FormatJSON writes one JSON object per line
+	FormatJSON = "json"
+)
+
+var (
+	format = FormatText
+	level  = new(slog.LevelVar)
+)
+
+// Configure sets the format and minimum level of the logs, including those written with the log package
+func Configure(logFormat string, logLevel string) error {
+	switch logFormat {
+	case FormatText, FormatJSON:
+		format = logFormat
+	default:
+		return fmt.Errorf("unknown log_format: %q, want %s or %s", logFormat, FormatText, FormatJSON)
+	}
+
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(logLevel)); err != nil {
+		return fmt.Errorf("unknown log_level: %q", logLevel)
+	}
+	level.Set(l)
+
+	slog.SetDefault(New(os.Stderr))
+	return nil
+}
+
+// New returns a logger writing to output in the configured format
+func New(output io.Writer) *slog.Logger {
+	if format == FormatJSON {
+		return slog.New(slog.NewJSONHandler(output, &slog.HandlerOptions{Level: level}))
+	}
+	return slog.New(&textHandler{logger: log.New(output, "", log.LstdFlags)})
+}
+
+// textHandler formats records as the log package does. A stream attribute,
+// as set for the output of the function, prefixes the message.
+type textHandler struct {
+	logger *log.Logger
+	attrs  []slog.Attr
+}
+
+func (h *textHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var prefix string
+	var fields strings.Builder
+
+	write := func(a slog.Attr) bool {
+		if a.Key == "stream" {
+			prefix = a.Value.String() + ": "
+		} else {
+			fmt.Fprintf(&fields, " %s=%s", a.Key, a.Value.String())
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(write)
+
+	if r.Level != slog.LevelInfo {
+		prefix = r.Level.String() + " " + prefix
+	}
+
+	return h.logger.Output(0, prefix+strings.TrimSuffix(r.Message, "\n")+fields.String())
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &textHandler{
+		logger: h.logger,
+		attrs:  append(append([]slog.Attr{}, h.attrs...), attrs...),
+	}
+}
+
+// WithGroup is not used by the watchdog, groups are flattened
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	return h
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func withFormat(t *testing.T, f string) {
+	previous := format
+	format = f
+	t.Cleanup(func() { format = previous })
+}
+
+func Test_New_JSONIncludesCallIDAndStream(t *testing.T) {
+	withFormat(t, FormatJSON)
+
+	var out bytes.Buffer
+	New(&out).With("stream", "stderr", "call_id", "abc").Info("Processing request")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("want a JSON line, got %q: %s", out.String(), err)
+	}
+
+	for key, want := range map[string]string{"msg": "Processing request", "stream": "stderr", "call_id": "abc", "level": "INFO"} {
+		if line[key] != want {
+			t.Errorf("%s, want: %q, got: %v", key, want, line[key])
+		}
+	}
+}
+
+func Test_New_TextKeepsStreamPrefix(t *testing.T) {
+	withFormat(t, FormatText)
+
+	var out bytes.Buffer
+	New(&out).With("stream", "stderr").Info("Processing request\n")
+
+	got := strings.TrimSpace(out.String())
+	if !strings.HasSuffix(got, "stderr: Processing request") {
+		t.Errorf("want the classic stream prefix, got: %q", got)
+	}
+}
+
+func Test_New_TextAppendsFieldsAndLevel(t *testing.T) {
+	withFormat(t, FormatText)
+
+	var out bytes.Buffer
+	New(&out).With("call_id", "abc").Warn("slow")
+
+	got := strings.TrimSpace(out.String())
+	if !strings.HasSuffix(got, "WARN slow call_id=abc") {
+		t.Errorf("want level and fields, got: %q", got)
+	}
+}
+
+func Test_Configure_RejectsUnknownFormatAndLevel(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	if err := Configure("xml", "info"); err == nil {
+		t.Errorf("want an error for an unknown format")
+	}
+	if err := Configure(FormatText, "loud"); err == nil {
+		t.Errorf("want an error for an unknown level")
+	}
+}
+
+func Test_Middleware_EchoesCallID(t *testing.T) {
+	var got string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = CallID(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(CallIDHeader, "abc")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got != "abc" {
+		t.Errorf("context call ID, want: %q, got: %q", "abc", got)
+	}
+	if echoed := rr.Header().Get(CallIDHeader); echoed != "abc" {
+		t.Errorf("response %s, want: %q, got: %q", CallIDHeader, "abc", echoed)
+	}
+}
+
+func Test_Middleware_GeneratesCallID(t *testing.T) {
+	var header string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(CallIDHeader)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	echoed := rr.Header().Get(CallIDHeader)
+	if len(echoed) != 32 {
+		t.Fatalf("want a generated call ID, got: %q", echoed)
+	}
+	if header != echoed {
+		t.Errorf("want the generated call ID passed on to the function, got: %q", header)
+	}
+}
+
+func Test_CallID_EmptyWithoutMiddleware(t *testing.T) {
+	if got := CallID(context.Background()); got != "" {
+		t.Errorf("want no call ID, got: %q", got)
+	}
+}
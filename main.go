@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -11,19 +12,29 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
 
 	limiter "github.com/openfaas/faas-middleware/concurrency-limiter"
+	"github.com/paulofelipefeitosa/of-watchdog/admission"
+	"github.com/paulofelipefeitosa/of-watchdog/async"
+	"github.com/paulofelipefeitosa/of-watchdog/auth"
+	"github.com/paulofelipefeitosa/of-watchdog/certs"
 	"github.com/paulofelipefeitosa/of-watchdog/config"
 	"github.com/paulofelipefeitosa/of-watchdog/executor"
+	"github.com/paulofelipefeitosa/of-watchdog/logging"
 	"github.com/paulofelipefeitosa/of-watchdog/metrics"
+	"github.com/paulofelipefeitosa/of-watchdog/tracing"
 )
 
 var (
 	acceptingConnections int32
+
+	// functionHealthy is cleared while a long-running function process is restarting
+	functionHealthy int32 = 1
 )
 
 func main() {
@@ -54,12 +65,43 @@ func main() {
 		os.Exit(1)
 	}
 
-	requestHandler := buildRequestHandler(watchdogConfig)
+	if err := watchdogConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := logging.Configure(watchdogConfig.LogFormat, watchdogConfig.LogLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+
+	var exporter *tracing.OTLPExporter
+	if len(watchdogConfig.OTLPEndpoint) > 0 {
+		exporter = tracing.NewOTLPExporter(watchdogConfig.OTLPEndpoint, watchdogConfig.OTelServiceName)
+		tracing.SetExporter(exporter)
+		log.Printf("Tracing to: %s\n", exporter)
+	}
+
+	httpMetrics := metrics.NewHttp(config.WatchdogMode(watchdogConfig.OperationalMode))
+	requestHandler, waitReady := buildRequestHandler(watchdogConfig, httpMetrics)
+
+	if len(watchdogConfig.AccessLog) > 0 {
+		accessLog, err := logging.NewAccessLog(requestHandler, watchdogConfig.AccessLog, os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+		requestHandler = accessLog
+	}
 
 	log.Printf("OperationalMode: %s\n", config.WatchdogMode(watchdogConfig.OperationalMode))
 
-	httpMetrics := metrics.NewHttp()
-	http.HandleFunc("/", metrics.InstrumentHandler(requestHandler, httpMetrics))
+	// Health checks are served without a client certificate, function calls require one
+	if len(watchdogConfig.TLSClientCAFile) > 0 {
+		requestHandler = certs.RequireClientCert(requestHandler)
+	}
+
+	http.Handle("/", logging.Middleware(metrics.InstrumentHandler(tracing.Middleware(requestHandler), httpMetrics)))
 	http.HandleFunc("/_/health", makeHealthHandler())
 
 	metricsServer := metrics.MetricsServer{}
@@ -77,13 +119,34 @@ func main() {
 		MaxHeaderBytes: 1 << 20, // Max header of 1MB
 	}
 
+	tlsConfig, stopReload, err := makeTLSConfig(watchdogConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+	s.TLSConfig = tlsConfig
+
+	if watchdogConfig.H2C {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		// HTTP/2 is still negotiated over TLS
+		protocols.SetHTTP2(tlsConfig != nil)
+		s.Protocols = protocols
+	}
+
 	log.Printf("Timeouts: read: %s, write: %s hard: %s.\n",
 		watchdogConfig.HTTPReadTimeout,
 		watchdogConfig.HTTPWriteTimeout,
 		watchdogConfig.ExecTimeout)
 	log.Printf("Listening on port: %d\n", watchdogConfig.TCPPort)
 
-	listenUntilShutdown(shutdownTimeout, s, watchdogConfig.SuppressLock)
+	listenUntilShutdown(shutdownTimeout, s, watchdogConfig.SuppressLock, waitReady)
+	close(stopReload)
+
+	if exporter != nil {
+		exporter.Shutdown()
+	}
 }
 
 func markUnhealthy() error {
@@ -95,7 +158,7 @@ func markUnhealthy() error {
 	return removeErr
 }
 
-func listenUntilShutdown(shutdownTimeout time.Duration, s *http.Server, suppressLock bool) {
+func listenUntilShutdown(shutdownTimeout time.Duration, s *http.Server, suppressLock bool, waitReady func() error) {
 
 	idleConnsClosed := make(chan struct{})
 	go func() {
@@ -128,12 +191,24 @@ func listenUntilShutdown(shutdownTimeout time.Duration, s *http.Server, suppress
 
 	// Run the HTTP server in a separate go-routine.
 	go func() {
-		if err := s.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if s.TLSConfig != nil {
+			// The certificate is served by TLSConfig.GetCertificate
+			err = s.ListenAndServeTLS("", "")
+		} else {
+			err = s.ListenAndServe()
+		}
+
+		if err != http.ErrServerClosed {
 			log.Printf("Error ListenAndServe: %v", err)
 			close(idleConnsClosed)
 		}
 	}()
 
+	if readyErr := waitReady(); readyErr != nil {
+		log.Fatalf("Function did not become ready: %s\n", readyErr.Error())
+	}
+
 	if suppressLock == false {
 		path, writeErr := createLockFile()
 
@@ -149,21 +224,31 @@ func listenUntilShutdown(shutdownTimeout time.Duration, s *http.Server, suppress
 	<-idleConnsClosed
 }
 
-func buildRequestHandler(watchdogConfig config.WatchdogConfig) http.Handler {
+// buildRequestHandler returns the handler for the configured mode and a function
+// which blocks until the function is ready to receive requests.
+func buildRequestHandler(watchdogConfig config.WatchdogConfig, httpMetrics metrics.Http) (http.Handler, func() error) {
 	var requestHandler http.HandlerFunc
+	waitReady := func() error {
+		return nil
+	}
+
+	var resources metrics.Resources
+	if watchdogConfig.OperationalMode != config.ModeStatic {
+		resources = metrics.NewResources()
+	}
 
 	switch watchdogConfig.OperationalMode {
 	case config.ModeStreaming:
-		requestHandler = makeForkRequestHandler(watchdogConfig)
+		requestHandler = makeForkRequestHandler(watchdogConfig, &resources)
 		break
 	case config.ModeSerializing:
-		requestHandler = makeSerializingForkRequestHandler(watchdogConfig)
+		requestHandler = makeSerializingForkRequestHandler(watchdogConfig, &resources)
 		break
 	case config.ModeAfterBurn:
-		requestHandler = makeAfterBurnRequestHandler(watchdogConfig)
+		requestHandler = makeAfterBurnRequestHandler(watchdogConfig, &resources)
 		break
 	case config.ModeHTTP:
-		requestHandler = makeHTTPRequestHandler(watchdogConfig)
+		requestHandler, waitReady = makeHTTPRequestHandler(watchdogConfig, &resources)
 		break
 	case config.ModeStatic:
 		requestHandler = makeStaticRequestHandler(watchdogConfig)
@@ -172,11 +257,121 @@ func buildRequestHandler(watchdogConfig config.WatchdogConfig) http.Handler {
 		break
 	}
 
-	if watchdogConfig.MaxInflight > 0 {
-		return limiter.NewConcurrencyLimiter(requestHandler, watchdogConfig.MaxInflight)
+	handler := metrics.InstrumentInflight(logging.Upstream(requestHandler), httpMetrics)
+	if watchdogConfig.MaxInflight > 0 && watchdogConfig.InflightQueueDepth > 0 {
+		admissionMetrics := metrics.NewAdmission()
+		handler = metrics.InstrumentLimiter(handler, tracing.Queue(func(next http.Handler) http.Handler {
+			waitQueue := admission.NewWaitQueue(next, watchdogConfig.MaxInflight, watchdogConfig.InflightQueueDepth, watchdogConfig.InflightQueueWait)
+			waitQueue.Metrics = &admissionMetrics
+			return waitQueue
+		}), httpMetrics)
+	} else if watchdogConfig.MaxInflight > 0 {
+		handler = metrics.InstrumentLimiter(handler, tracing.Queue(func(next http.Handler) http.Handler {
+			return limiter.NewConcurrencyLimiter(next, watchdogConfig.MaxInflight)
+		}), httpMetrics)
+	}
+
+	if watchdogConfig.AsyncWorkers > 0 {
+		handler = makeAsyncHandler(watchdogConfig, handler)
+	}
+
+	// Requests are authenticated before they are queued, within the body limit
+	// as the body is read to check its signature
+	handler = makeAuthHandler(watchdogConfig, handler)
+
+	if watchdogConfig.MaxRequestBytes > 0 {
+		handler = admission.LimitBody(handler, watchdogConfig.MaxRequestBytes)
+	}
+
+	return handler, waitReady
+}
+
+// makeTLSConfig returns nil when TLS is not enabled, otherwise a config which serves the
+// certificate files and reloads them when they change, until the returned channel is closed
+func makeTLSConfig(watchdogConfig config.WatchdogConfig) (*tls.Config, chan struct{}, error) {
+	stop := make(chan struct{})
+	if len(watchdogConfig.TLSCertFile) == 0 && len(watchdogConfig.TLSKeyFile) == 0 {
+		return nil, stop, nil
+	}
+
+	if len(watchdogConfig.TLSCertFile) == 0 || len(watchdogConfig.TLSKeyFile) == 0 {
+		return nil, stop, fmt.Errorf("provide both tls_cert_file and tls_key_file to enable TLS")
+	}
+
+	reloader, err := certs.NewReloader(watchdogConfig.TLSCertFile, watchdogConfig.TLSKeyFile)
+	if err != nil {
+		return nil, stop, err
+	}
+
+	tlsConfig, err := certs.NewConfig(reloader, watchdogConfig.TLSClientCAFile)
+	if err != nil {
+		return nil, stop, err
+	}
+
+	if watchdogConfig.TLSReloadInterval > 0 {
+		go reloader.Watch(watchdogConfig.TLSReloadInterval, stop)
+	}
+
+	log.Printf("TLS enabled with certificate: %s\n", watchdogConfig.TLSCertFile)
+	return tlsConfig, stop, nil
+}
+
+// makeAuthHandler rejects unauthenticated requests when credentials are configured
+func makeAuthHandler(watchdogConfig config.WatchdogConfig, handler http.Handler) http.Handler {
+	authenticator := &auth.Authenticator{
+		Handler:         handler,
+		SignatureHeader: watchdogConfig.HMACSignatureHeader,
+	}
+
+	var err error
+	if len(watchdogConfig.BasicAuthUserFile) > 0 || len(watchdogConfig.BasicAuthPasswordFile) > 0 {
+		if authenticator.BasicUser, err = auth.ReadSecret(watchdogConfig.BasicAuthUserFile); err != nil {
+			log.Fatalf("basic_auth_user_file: %s", err.Error())
+		}
+		if authenticator.BasicPassword, err = auth.ReadSecret(watchdogConfig.BasicAuthPasswordFile); err != nil {
+			log.Fatalf("basic_auth_password_file: %s", err.Error())
+		}
+	}
+
+	if len(watchdogConfig.BearerTokensFile) > 0 {
+		if authenticator.BearerTokens, err = auth.ReadTokens(watchdogConfig.BearerTokensFile); err != nil {
+			log.Fatalf("bearer_tokens_file: %s", err.Error())
+		}
+	}
+
+	if len(watchdogConfig.HMACSecretFile) > 0 {
+		secret, err := auth.ReadSecret(watchdogConfig.HMACSecretFile)
+		if err != nil {
+			log.Fatalf("hmac_secret_file: %s", err.Error())
+		}
+		authenticator.HMACSecret = []byte(secret)
+	}
+
+	if !authenticator.Enabled() {
+		return handler
 	}
 
-	return requestHandler
+	log.Printf("Authentication required for function requests\n")
+	return authenticator
+}
+
+// makeAsyncHandler runs calls to /async-function/ or with X-Async: true in the background
+func makeAsyncHandler(watchdogConfig config.WatchdogConfig, handler http.Handler) http.HandlerFunc {
+	queue := &async.Queue{
+		Handler: handler,
+		Workers: watchdogConfig.AsyncWorkers,
+		Size:    watchdogConfig.AsyncQueueSize,
+		Timeout: watchdogConfig.AsyncTimeout,
+	}
+	queue.Start()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if async.IsAsync(r) {
+			queue.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}
 }
 
 // createLockFile returns a path to a lock file and/or an error
@@ -199,16 +394,32 @@ func createLockFile() (string, error) {
 	return path, nil
 }
 
-func makeAfterBurnRequestHandler(watchdogConfig config.WatchdogConfig) func(http.ResponseWriter, *http.Request) {
+func makeAfterBurnRequestHandler(watchdogConfig config.WatchdogConfig, resources *metrics.Resources) func(http.ResponseWriter, *http.Request) {
 
 	commandName, arguments := watchdogConfig.Process()
-	functionInvoker := executor.AfterBurnFunctionRunner{
-		Process:     commandName,
-		ProcessArgs: arguments,
+
+	afterBurnMetrics := metrics.NewAfterBurn()
+	functionInvoker := executor.AfterBurnPool{
+		Metrics:        &afterBurnMetrics,
+		ExecTimeout:    watchdogConfig.ExecTimeout,
+		OnHealthChange: setFunctionHealthy,
 	}
 
-	log.Printf("Forking %s %s\n", commandName, arguments)
-	functionInvoker.Start()
+	for i := 0; i < watchdogConfig.AfterBurnWorkers; i++ {
+		functionInvoker.Workers = append(functionInvoker.Workers, &executor.AfterBurnFunctionRunner{
+			ExecTimeout: watchdogConfig.ExecTimeout,
+			Process:     commandName,
+			ProcessArgs: arguments,
+			Supervisor:  makeSupervisor(watchdogConfig),
+			Sampler:     makeResourceSampler(watchdogConfig, resources, strconv.Itoa(i)),
+			Headers:     makeHeaderFilter(watchdogConfig),
+		})
+	}
+
+	log.Printf("Forking %d workers: %s %s\n", watchdogConfig.AfterBurnWorkers, commandName, arguments)
+	if err := functionInvoker.Start(); err != nil {
+		log.Fatalf("Unable to start function: %s", err.Error())
+	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -219,30 +430,34 @@ func makeAfterBurnRequestHandler(watchdogConfig config.WatchdogConfig) func(http
 			OutputWriter: w,
 		}
 
-		functionInvoker.Mutex.Lock()
-
 		err := functionInvoker.Run(req, r.ContentLength, r, w)
 
 		if err != nil {
 			w.WriteHeader(500)
 			w.Write([]byte(err.Error()))
 		}
-
-		functionInvoker.Mutex.Unlock()
 	}
 }
 
-func makeSerializingForkRequestHandler(watchdogConfig config.WatchdogConfig) func(http.ResponseWriter, *http.Request) {
+func makeSerializingForkRequestHandler(watchdogConfig config.WatchdogConfig, resources *metrics.Resources) func(http.ResponseWriter, *http.Request) {
 	functionInvoker := executor.SerializingForkFunctionRunner{
 		ExecTimeout: watchdogConfig.ExecTimeout,
+		Prefork:     makePreforkPool(watchdogConfig),
+		CGIResponse: watchdogConfig.CGIResponse,
+
+		ExitCodeStatus: watchdogConfig.ExitCodeStatus,
+		IncludeStderr:  watchdogConfig.IncludeStderr,
+		Resources:      resources,
 	}
 
+	headers := makeHeaderFilter(watchdogConfig)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var environment []string
 
 		if watchdogConfig.InjectCGIHeaders {
-			environment = getEnvironment(r)
+			environment = getEnvironment(r, headers)
 		}
 
 		commandName, arguments := watchdogConfig.Process()
@@ -253,27 +468,32 @@ func makeSerializingForkRequestHandler(watchdogConfig config.WatchdogConfig) fun
 			ContentLength: &r.ContentLength,
 			OutputWriter:  w,
 			Environment:   environment,
+			Context:       r.Context(),
 		}
 
 		w.Header().Set("Content-Type", watchdogConfig.ContentType)
 		err := functionInvoker.Run(req, w)
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(r.Context()).Error(err.Error())
 		}
 	}
 }
 
-func makeForkRequestHandler(watchdogConfig config.WatchdogConfig) func(http.ResponseWriter, *http.Request) {
+func makeForkRequestHandler(watchdogConfig config.WatchdogConfig, resources *metrics.Resources) func(http.ResponseWriter, *http.Request) {
 	functionInvoker := executor.ForkFunctionRunner{
 		ExecTimeout: watchdogConfig.ExecTimeout,
+		Prefork:     makePreforkPool(watchdogConfig),
+		Resources:   resources,
 	}
 
+	headers := makeHeaderFilter(watchdogConfig)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var environment []string
 
 		if watchdogConfig.InjectCGIHeaders {
-			environment = getEnvironment(r)
+			environment = getEnvironment(r, headers)
 		}
 
 		commandName, arguments := watchdogConfig.Process()
@@ -283,25 +503,61 @@ func makeForkRequestHandler(watchdogConfig config.WatchdogConfig) func(http.Resp
 			InputReader:  r.Body,
 			OutputWriter: w,
 			Environment:  environment,
+			Context:      r.Context(),
 		}
 
 		w.Header().Set("Content-Type", watchdogConfig.ContentType)
+
+		// The status has been sent by the time the process exits, so the outcome is sent in trailers
+		w.Header().Set("Trailer", "X-Exit-Code, X-Duration-Seconds, X-Function-Error")
+
+		startedTime := time.Now()
 		err := functionInvoker.Run(req)
+
+		w.Header().Set("X-Exit-Code", strconv.Itoa(executor.ExitCode(err)))
+		w.Header().Set("X-Duration-Seconds", fmt.Sprintf("%f", time.Since(startedTime).Seconds()))
 		if err != nil {
-			log.Println(err.Error())
+			logging.FromContext(r.Context()).Error(err.Error())
 
-			// Probably cannot write to client if we already have written a header
-			// w.WriteHeader(500)
-			// w.Write([]byte(err.Error()))
+			w.Header().Set("X-Function-Error", err.Error())
 		}
 	}
 }
 
-func getEnvironment(r *http.Request) []string {
+// makePreforkPool starts the pool of warm processes when prefork_pool_size is set
+func makePreforkPool(watchdogConfig config.WatchdogConfig) *executor.PreforkPool {
+	if watchdogConfig.PreforkPoolSize <= 0 {
+		return nil
+	}
+
+	commandName, arguments := watchdogConfig.Process()
+	pool := &executor.PreforkPool{
+		Process:     commandName,
+		ProcessArgs: arguments,
+		Size:        watchdogConfig.PreforkPoolSize,
+	}
+
+	log.Printf("Preforking %d processes: %s %s\n", pool.Size, commandName, arguments)
+	if err := pool.Start(); err != nil {
+		log.Fatalf("Unable to prefork function: %s", err.Error())
+	}
+
+	return pool
+}
+
+// makeHeaderFilter returns the filter of the headers passed to the function, or nil to pass them all
+func makeHeaderFilter(watchdogConfig config.WatchdogConfig) *executor.HeaderFilter {
+	return executor.NewHeaderFilter(watchdogConfig.DropRequestHeaders, watchdogConfig.ForwardRequestHeaders)
+}
+
+func getEnvironment(r *http.Request, headers *executor.HeaderFilter) []string {
 	var envs []string
 
 	envs = os.Environ()
 	for k, v := range r.Header {
+		if !headers.Allowed(k) {
+			continue
+		}
 		kv := fmt.Sprintf("Http_%s=%s", strings.Replace(k, "-", "_", -1), v[0])
 		envs = append(envs, kv)
 	}
@@ -318,7 +574,7 @@ func getEnvironment(r *http.Request) []string {
 	return envs
 }
 
-func makeHTTPRequestHandler(watchdogConfig config.WatchdogConfig) func(http.ResponseWriter, *http.Request) {
+func makeHTTPRequestHandler(watchdogConfig config.WatchdogConfig, resources *metrics.Resources) (func(http.ResponseWriter, *http.Request), func() error) {
 	commandName, arguments := watchdogConfig.Process()
 	functionInvoker := executor.HTTPFunctionRunner{
 		ExecTimeout:    watchdogConfig.ExecTimeout,
@@ -328,8 +584,19 @@ func makeHTTPRequestHandler(watchdogConfig config.WatchdogConfig) func(http.Resp
 		CRIUExec:       watchdogConfig.CRIUExec,
 		StartupTime:    -1,
 		RestoreLogPath: watchdogConfig.RestoreLogPath,
+		Supervisor:     makeSupervisor(watchdogConfig),
+
+		BufferHTTPResponse: watchdogConfig.BufferHTTPResponse,
+		FlushInterval:      watchdogConfig.HTTPFlushInterval,
+		UpgradeIdleTimeout: watchdogConfig.UpgradeIdleTimeout,
+		UpstreamH2C:        watchdogConfig.UpstreamH2C,
+		Sampler:            makeResourceSampler(watchdogConfig, resources, "0"),
+		Headers:            makeHeaderFilter(watchdogConfig),
 	}
 
+	startupMetrics := metrics.NewStartup()
+	functionInvoker.StartupMetrics = &startupMetrics
+
 	if len(watchdogConfig.UpstreamURL) == 0 {
 		log.Fatal(`For "mode=http" you must specify a valid URL for "http_upstream_url"`)
 	}
@@ -340,8 +607,31 @@ func makeHTTPRequestHandler(watchdogConfig config.WatchdogConfig) func(http.Resp
 	}
 	functionInvoker.UpstreamURL = urlValue
 
+	if watchdogConfig.CRIUCheckpoint {
+		functionInvoker.CRIU = &executor.CRIU{
+			Binary:    watchdogConfig.CRIUBinary,
+			ImagesDir: watchdogConfig.CRIUImagesDir,
+			LogPath:   watchdogConfig.RestoreLogPath,
+		}
+	}
+	functionInvoker.WarmupTimeout = watchdogConfig.CRIUWarmupTimeout
+
+	if len(watchdogConfig.ReadinessProbe) > 0 {
+		functionInvoker.Readiness = &executor.ReadinessProbe{
+			Type:        watchdogConfig.ReadinessProbe,
+			UpstreamURL: urlValue,
+			Path:        watchdogConfig.ReadinessPath,
+			Command:     strings.Fields(watchdogConfig.ReadinessCommand),
+			Interval:    watchdogConfig.ReadinessInterval,
+			Timeout:     watchdogConfig.ReadinessTimeout,
+			MaxWait:     watchdogConfig.ReadinessMaxWait,
+		}
+	}
+
 	fmt.Printf("Forking - %s %s\n", commandName, arguments)
-	functionInvoker.Start()
+	if err := functionInvoker.Start(); err != nil {
+		log.Fatalf("Unable to start function: %s", err.Error())
+	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -363,6 +653,41 @@ func makeHTTPRequestHandler(watchdogConfig config.WatchdogConfig) func(http.Resp
 			w.Write([]byte(err.Error()))
 		}
 
+	}, functionInvoker.WaitReady
+}
+
+// makeSupervisor applies the restart policy to the long-running function process,
+// and marks the watchdog unhealthy while the process is restarting.
+func makeSupervisor(watchdogConfig config.WatchdogConfig) *executor.Supervisor {
+	return &executor.Supervisor{
+		Policy:         watchdogConfig.RestartPolicy,
+		Backoff:        watchdogConfig.RestartBackoff,
+		MaxBackoff:     watchdogConfig.RestartMaxBackoff,
+		MaxRestarts:    watchdogConfig.MaxRestarts,
+		OnHealthChange: setFunctionHealthy,
+	}
+}
+
+// makeResourceSampler samples the resource usage of a long-running function process,
+// process labels the samples. Sampling is disabled when the interval is not positive.
+func makeResourceSampler(watchdogConfig config.WatchdogConfig, resources *metrics.Resources, process string) *executor.ResourceSampler {
+	if resources == nil || watchdogConfig.ResourceSampleInterval <= 0 {
+		return nil
+	}
+
+	return &executor.ResourceSampler{
+		Metrics:  resources,
+		Interval: watchdogConfig.ResourceSampleInterval,
+		Process:  process,
+		Start:    metrics.StartCold,
+	}
+}
+
+func setFunctionHealthy(healthy bool) {
+	if healthy {
+		atomic.StoreInt32(&functionHealthy, 1)
+	} else {
+		atomic.StoreInt32(&functionHealthy, 0)
 	}
 }
 
@@ -388,7 +713,7 @@ func makeHealthHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			if atomic.LoadInt32(&acceptingConnections) == 0 || lockFilePresent() == false {
+			if atomic.LoadInt32(&acceptingConnections) == 0 || atomic.LoadInt32(&functionHealthy) == 0 || lockFilePresent() == false {
 				w.WriteHeader(http.StatusServiceUnavailable)
 				return
 			}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Admission records the requests waiting for a free slot once max_inflight is reached
+type Admission struct {
+	QueueDepth       prometheus.Gauge
+	QueueWaitSeconds prometheus.Histogram
+}
+
+// NewAdmission registers the admission queue collectors
+func NewAdmission() Admission {
+	return Admission{
+		QueueDepth: promauto.NewGauge(prometheus.GaugeOpts{
+			Subsystem: "admission",
+			Name:      "queue_depth",
+			Help:      "Requests waiting for an inflight slot.",
+		}),
+		QueueWaitSeconds: promauto.NewHistogram(prometheus.HistogramOpts{
+			Subsystem: "admission",
+			Name:      "queue_wait_seconds",
+			Help:      "Seconds spent by requests waiting for an inflight slot.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+	}
+}
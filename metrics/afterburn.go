@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// AfterBurn records the use and health of each afterburn worker process
+type AfterBurn struct {
+	WorkerRequestsTotal *prometheus.CounterVec
+	WorkerHealthy       *prometheus.GaugeVec
+	WorkersBusy         prometheus.Gauge
+}
+
+// NewAfterBurn registers the afterburn collectors
+func NewAfterBurn() AfterBurn {
+	return AfterBurn{
+		WorkerRequestsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "afterburn",
+			Name:      "worker_requests_total",
+			Help:      "Total requests processed by each afterburn worker.",
+		}, []string{"worker"}),
+		WorkerHealthy: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "afterburn",
+			Name:      "worker_healthy",
+			Help:      "1 when the afterburn worker process is up, 0 while it is restarting.",
+		}, []string{"worker"}),
+		WorkersBusy: promauto.NewGauge(prometheus.GaugeOpts{
+			Subsystem: "afterburn",
+			Name:      "workers_busy",
+			Help:      "Afterburn workers currently processing a request.",
+		}),
+	}
+}
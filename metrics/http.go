@@ -8,20 +8,45 @@ import (
 type Http struct {
 	RequestsTotal            *prometheus.CounterVec
 	RequestDurationHistogram *prometheus.HistogramVec
+
+	// InflightRequests is the number of requests admitted by the
+	// concurrency limiter and being processed by the function
+	InflightRequests prometheus.Gauge
+
+	// RejectedRequestsTotal counts requests answered by the concurrency
+	// limiter without reaching the function, i.e. once max_inflight is hit
+	RejectedRequestsTotal prometheus.Counter
 }
 
-func NewHttp() Http {
+// NewHttp registers the HTTP collectors, each labelled with the watchdog mode
+func NewHttp(mode string) Http {
+	modeLabel := prometheus.Labels{"mode": mode}
+
 	return Http{
 		RequestsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
-			Subsystem: "http",
-			Name:      "requests_total",
-			Help:      "total HTTP requests processed",
+			Subsystem:   "http",
+			Name:        "requests_total",
+			Help:        "total HTTP requests processed",
+			ConstLabels: modeLabel,
 		}, []string{"code", "method"}),
 		RequestDurationHistogram: promauto.NewHistogramVec(prometheus.HistogramOpts{
-			Subsystem: "http",
-			Name:      "request_duration_seconds",
-			Help:      "Seconds spent serving HTTP requests.",
-			Buckets:   prometheus.DefBuckets,
+			Subsystem:   "http",
+			Name:        "request_duration_seconds",
+			Help:        "Seconds spent serving HTTP requests.",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: modeLabel,
 		}, []string{"code", "method"}),
+		InflightRequests: promauto.NewGauge(prometheus.GaugeOpts{
+			Subsystem:   "http",
+			Name:        "requests_inflight",
+			Help:        "HTTP requests currently processed by the function.",
+			ConstLabels: modeLabel,
+		}),
+		RejectedRequestsTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Subsystem:   "http",
+			Name:        "requests_rejected_total",
+			Help:        "total HTTP requests rejected by the concurrency limiter",
+			ConstLabels: modeLabel,
+		}),
 	}
 }
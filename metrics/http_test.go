@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func makeTestHttp() Http {
+	return Http{
+		InflightRequests:      prometheus.NewGauge(prometheus.GaugeOpts{Name: "inflight"}),
+		RejectedRequestsTotal: prometheus.NewCounter(prometheus.CounterOpts{Name: "rejected"}),
+	}
+}
+
+func value(t *testing.T, metric prometheus.Metric) float64 {
+	m := &dto.Metric{}
+	if err := metric.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Gauge != nil {
+		return m.Gauge.GetValue()
+	}
+	return m.Counter.GetValue()
+}
+
+func Test_InstrumentLimiter_CountsRejections(t *testing.T) {
+	_http := makeTestHttp()
+
+	reject := false
+	limit := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if reject {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	var inflight float64
+	next := InstrumentInflight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inflight = value(t, _http.InflightRequests)
+	}), _http)
+
+	handler := InstrumentLimiter(next, limit, _http)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if inflight != 1 {
+		t.Errorf("want 1 request in flight while the function runs, got: %f", inflight)
+	}
+	if got := value(t, _http.InflightRequests); got != 0 {
+		t.Errorf("want 0 requests in flight once done, got: %f", got)
+	}
+
+	reject = true
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := value(t, _http.RejectedRequestsTotal); got != 2 {
+		t.Errorf("want 2 rejected requests, got: %f", got)
+	}
+}
@@ -63,3 +63,30 @@ func InstrumentHandler(next http.Handler, _http Http) http.HandlerFunc {
 	return promhttp.InstrumentHandlerCounter(_http.RequestsTotal,
 		promhttp.InstrumentHandlerDuration(_http.RequestDurationHistogram, next))
 }
+
+type admittedKey struct{}
+
+// InstrumentInflight returns a handler which records the requests in flight through next
+func InstrumentInflight(next http.Handler, _http Http) http.Handler {
+	return promhttp.InstrumentHandlerInFlight(_http.InflightRequests, next)
+}
+
+// InstrumentLimiter returns the handler built by limit around next, and records
+// the requests which the limiter answers itself instead of passing them to next.
+func InstrumentLimiter(next http.Handler, limit func(http.Handler) http.Handler, _http Http) http.HandlerFunc {
+	limited := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if admitted, ok := r.Context().Value(admittedKey{}).(*bool); ok {
+			*admitted = true
+		}
+		next.ServeHTTP(w, r)
+	}))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		admitted := false
+		limited.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), admittedKey{}, &admitted)))
+
+		if !admitted {
+			_http.RejectedRequestsTotal.Inc()
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Resources records the resource usage of function processes, labelled with
+// start as StartCold, StartRestored or StartPreforked so that the ways to start them can be compared
+type Resources struct {
+	// CPUSeconds, MaxRSSBytes and PageFaults are observed once a forked process has exited
+	CPUSeconds  *prometheus.HistogramVec
+	MaxRSSBytes *prometheus.HistogramVec
+	PageFaults  *prometheus.HistogramVec
+
+	// SampledCPUSeconds, SampledRSSBytes and SampledPageFaults are sampled
+	// periodically from a long-running process, labelled with process
+	SampledCPUSeconds *prometheus.GaugeVec
+	SampledRSSBytes   *prometheus.GaugeVec
+	SampledPageFaults *prometheus.GaugeVec
+}
+
+// NewResources registers the function resource collectors
+func NewResources() Resources {
+	return Resources{
+		CPUSeconds: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Subsystem: "function",
+			Name:      "cpu_seconds",
+			Help:      "User and system CPU seconds used by a forked function process.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"start"}),
+		MaxRSSBytes: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Subsystem: "function",
+			Name:      "max_rss_bytes",
+			Help:      "Maximum resident set size of a forked function process.",
+			Buckets:   prometheus.ExponentialBuckets(1<<20, 2, 12),
+		}, []string{"start"}),
+		PageFaults: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Subsystem: "function",
+			Name:      "page_faults",
+			Help:      "Minor and major page faults of a forked function process.",
+			Buckets:   prometheus.ExponentialBuckets(100, 4, 10),
+		}, []string{"start", "type"}),
+		SampledCPUSeconds: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "function",
+			Name:      "process_cpu_seconds",
+			Help:      "User and system CPU seconds used so far by the long-running function process.",
+		}, []string{"process", "start"}),
+		SampledRSSBytes: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "function",
+			Name:      "process_rss_bytes",
+			Help:      "Resident set size of the long-running function process.",
+		}, []string{"process", "start"}),
+		SampledPageFaults: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "function",
+			Name:      "process_page_faults",
+			Help:      "Minor and major page faults so far of the long-running function process.",
+		}, []string{"process", "start", "type"}),
+	}
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// StartCold labels a function process which was started from fprocess
+	StartCold = "cold"
+
+	// StartRestored labels a function process which was restored from a CRIU checkpoint
+	StartRestored = "restored"
+
+	// StartPreforked labels a function process which was started ahead of the call by the prefork pool
+	StartPreforked = "preforked"
+)
+
+// Startup records how long the function took to become available
+type Startup struct {
+	ProcessStartSeconds    *prometheus.GaugeVec
+	FirstHealthySeconds    *prometheus.GaugeVec
+	FunctionStartupSeconds *prometheus.GaugeVec
+	RestoreDurationSeconds prometheus.Gauge
+	RestorePhaseSeconds    *prometheus.GaugeVec
+}
+
+// NewStartup registers the startup collectors
+func NewStartup() Startup {
+	startup := newStartup()
+	prometheus.MustRegister(startup.collectors()...)
+	return startup
+}
+
+// newStartup creates the startup collectors without registering them
+func newStartup() Startup {
+	return Startup{
+		ProcessStartSeconds: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "startup",
+			Name:      "process_start_seconds",
+			Help:      "Seconds taken to fork or restore the function process.",
+		}, []string{"start"}),
+		FirstHealthySeconds: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "startup",
+			Name:      "first_healthy_seconds",
+			Help:      "Seconds from starting the function process until the upstream first responded.",
+		}, []string{"start"}),
+		FunctionStartupSeconds: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "startup",
+			Name:      "function_seconds",
+			Help:      "Startup time reported in the X-App-Startup-Time header.",
+		}, []string{"start"}),
+		RestoreDurationSeconds: prometheus.NewGauge(prometheus.GaugeOpts{
+			Subsystem: "startup",
+			Name:      "restore_duration_seconds",
+			Help:      "Seconds taken by criu restore to return.",
+		}),
+		RestorePhaseSeconds: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "startup",
+			Name:      "restore_phase_seconds",
+			Help:      "Seconds taken to reach each restore phase from the previous one, or from the start of criu restore.",
+		}, []string{"phase"}),
+	}
+}
+
+func (s Startup) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		s.ProcessStartSeconds,
+		s.FirstHealthySeconds,
+		s.FunctionStartupSeconds,
+		s.RestoreDurationSeconds,
+		s.RestorePhaseSeconds,
+	}
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test_NewStartup_RegistersCollectors(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	startup := newStartup()
+	registry.MustRegister(startup.collectors()...)
+
+	startup.ProcessStartSeconds.WithLabelValues(StartCold).Set(0.5)
+	startup.FirstHealthySeconds.WithLabelValues(StartCold).Set(1)
+	startup.FunctionStartupSeconds.WithLabelValues(StartRestored).Set(0.2)
+	startup.RestoreDurationSeconds.Set(0.3)
+	startup.RestorePhaseSeconds.WithLabelValues("fork").Set(0.01)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]bool{}
+	for _, family := range families {
+		found[family.GetName()] = true
+	}
+
+	want := []string{
+		"startup_process_start_seconds",
+		"startup_first_healthy_seconds",
+		"startup_function_seconds",
+		"startup_restore_duration_seconds",
+		"startup_restore_phase_seconds",
+	}
+	for _, name := range want {
+		if !found[name] {
+			t.Errorf("want metric %s to be registered", name)
+		}
+	}
+}
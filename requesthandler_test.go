@@ -6,7 +6,11 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+
+	"github.com/paulofelipefeitosa/of-watchdog/config"
 )
 
 func TestHealthHandler_StatusOK_LockFilePresent(t *testing.T) {
@@ -83,3 +87,74 @@ func removeLockFile() error {
 	removeErr := os.Remove(path)
 	return removeErr
 }
+
+func TestHealthHandler_StatusServiceUnavailable_FunctionRestarting(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	if _, err := createLockFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer removeLockFile()
+
+	atomic.StoreInt32(&functionHealthy, 0)
+	defer atomic.StoreInt32(&functionHealthy, 1)
+
+	req, err := http.NewRequest(http.MethodGet, "/_/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := makeHealthHandler()
+	handler(rr, req)
+
+	required := http.StatusServiceUnavailable
+	if status := rr.Code; status != required {
+		t.Errorf("handler returned wrong status code - want: %v, got: %v", required, status)
+	}
+}
+
+func TestForkRequestHandler_SendsTrailers(t *testing.T) {
+	cases := []struct {
+		fprocess     string
+		wantExitCode string
+		wantError    bool
+	}{
+		{"cat", "0", false},
+		{"false", "1", true},
+	}
+
+	for _, testCase := range cases {
+		rr := httptest.NewRecorder()
+		watchdogConfig := config.New([]string{"fprocess=" + testCase.fprocess})
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello"))
+		handler := makeForkRequestHandler(watchdogConfig, nil)
+		handler(rr, req)
+
+		res := rr.Result()
+		if got := res.Trailer.Get("X-Exit-Code"); got != testCase.wantExitCode {
+			t.Errorf("(%s) X-Exit-Code want: %s, got: %s", testCase.fprocess, testCase.wantExitCode, got)
+		}
+		if got := res.Trailer.Get("X-Duration-Seconds"); len(got) == 0 {
+			t.Errorf("(%s) want X-Duration-Seconds trailer", testCase.fprocess)
+		}
+		if got := res.Trailer.Get("X-Function-Error"); (len(got) > 0) != testCase.wantError {
+			t.Errorf("(%s) X-Function-Error want error: %v, got: %q", testCase.fprocess, testCase.wantError, got)
+		}
+	}
+}
+
+func TestGetEnvironment_FiltersHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer gateway")
+	req.Header.Set("X-Tenant", "acme")
+
+	watchdogConfig := config.New([]string{"drop_request_headers=Authorization"})
+	env := strings.Join(getEnvironment(req, makeHeaderFilter(watchdogConfig)), "\n")
+
+	if strings.Contains(env, "Http_Authorization=") {
+		t.Errorf("want Http_Authorization dropped")
+	}
+	if !strings.Contains(env, "Http_X_Tenant=acme") {
+		t.Errorf("want Http_X_Tenant passed to the function")
+	}
+}
@@ -0,0 +1,56 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_StatusWriter_RecordsFirstStatus(t *testing.T) {
+	w := NewStatusWriter(httptest.NewRecorder())
+	w.WriteHeader(http.StatusNotFound)
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte("not found"))
+
+	if w.Status != http.StatusNotFound || w.Bytes != int64(len("not found")) {
+		t.Errorf("want 404 with 9 bytes, got: %d with %d bytes", w.Status, w.Bytes)
+	}
+}
+
+func Test_StatusWriter_DefaultsToOK(t *testing.T) {
+	w := NewStatusWriter(httptest.NewRecorder())
+	w.Write([]byte("ok"))
+	w.WriteHeader(http.StatusBadGateway)
+
+	if w.Status != http.StatusOK {
+		t.Errorf("want 200 once the body was written, got: %d", w.Status)
+	}
+}
+
+func Test_StatusWriter_HijackIsSwitchingProtocols(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w := NewStatusWriter(rw)
+		conn, _, err := w.Hijack()
+		if err != nil {
+			t.Errorf("want the connection hijacked, got: %s", err)
+			return
+		}
+		conn.Close()
+
+		if w.Status != http.StatusSwitchingProtocols {
+			t.Errorf("want 101 for a hijacked connection, got: %d", w.Status)
+		}
+	}))
+	defer srv.Close()
+
+	if res, err := http.Get(srv.URL); err == nil {
+		res.Body.Close()
+	}
+}
+
+func Test_StatusWriter_HijackUnsupported(t *testing.T) {
+	w := NewStatusWriter(httptest.NewRecorder())
+	if _, _, err := w.Hijack(); err == nil {
+		t.Errorf("want an error when the writer cannot be hijacked")
+	}
+}
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/paulofelipefeitosa/of-watchdog/response"
+)
+
+// Middleware starts a server span for each request, as a child of its traceparent header
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentExporter() == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// An invalid traceparent starts a new trace
+		parent, _ := ParseTraceparent(r.Header.Get(TraceparentHeader))
+
+		ctx, span := startSpan(r.Context(), r.Method, KindServer, parent)
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		defer span.Finish()
+
+		sw := response.NewStatusWriter(w)
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttribute("http.response.status_code", strconv.Itoa(sw.Status))
+		if sw.Status >= http.StatusInternalServerError {
+			span.SetError()
+		}
+	})
+}
+
+// Queue traces the time a request spends in a concurrency limiter built by limit,
+// until the limiter passes it on or rejects it.
+func Queue(limit func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limited := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Finish()
+
+			// The function is a sibling of the queue span
+			if parent := r.Context().Value(queueParentKey{}); parent != nil {
+				r = r.WithContext(withSpan(r.Context(), parent.(*Span)))
+			}
+			next.ServeHTTP(w, r)
+		}))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parent := FromContext(r.Context())
+			ctx, span := StartSpan(r.Context(), "queue", KindInternal)
+			if span == nil {
+				limited.ServeHTTP(w, r)
+				return
+			}
+			defer span.Finish()
+
+			if parent != nil {
+				ctx = withQueueParent(ctx, parent)
+			}
+			limited.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+type queueParentKey struct{}
+
+// withQueueParent keeps the span which the queue span is a child of
+func withQueueParent(ctx context.Context, parent *Span) context.Context {
+	return context.WithValue(ctx, queueParentKey{}, parent)
+}
@@ -0,0 +1,241 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBatchSize is the number of spans sent in one export request
+	defaultBatchSize = 256
+
+	// defaultExportInterval is the maximum time an ended span waits to be exported
+	defaultExportInterval = time.Second
+
+	// exportQueueSize is the number of spans kept while the collector is slow, beyond which they are dropped
+	exportQueueSize = 4096
+)
+
+// OTLPExporter sends spans to an OpenTelemetry collector with OTLP/HTTP in its JSON encoding
+type OTLPExporter struct {
+	Endpoint    string // Endpoint of the collector, i.e. http://collector:4318, to which /v1/traces is added
+	ServiceName string
+	Client      *http.Client
+
+	spans    chan *Span
+	stop     chan struct{} // stop is closed by Shutdown, after which spans are dropped
+	stopOnce sync.Once
+	done     chan struct{} // done is closed once the queued spans have been sent
+}
+
+// NewOTLPExporter starts an exporter which sends batches of spans in the background
+func NewOTLPExporter(endpoint string, serviceName string) *OTLPExporter {
+	e := &OTLPExporter{
+		Endpoint:    strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		ServiceName: serviceName,
+		Client:      &http.Client{Timeout: time.Second * 10},
+		spans:       make(chan *Span, exportQueueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	go e.run()
+	return e
+}
+
+// Export queues the span, it is dropped if the queue is full or the exporter is shut down
+func (e *OTLPExporter) Export(span *Span) {
+	select {
+	case <-e.stop:
+		return
+	default:
+	}
+
+	select {
+	case <-e.stop:
+	case e.spans <- span:
+	default:
+		log.Printf("Trace export queue is full, dropping span %s\n", span.Name)
+	}
+}
+
+// Shutdown exports the spans which are still queued. Spans ended from then on are dropped,
+// the queue itself is never closed as requests may still be ending spans.
+func (e *OTLPExporter) Shutdown() {
+	e.stopOnce.Do(func() { close(e.stop) })
+	<-e.done
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(defaultExportInterval)
+	defer ticker.Stop()
+
+	batch := []*Span{}
+	for {
+		select {
+		case <-e.stop:
+			for {
+				select {
+				case span := <-e.spans:
+					batch = append(batch, span)
+				default:
+					e.send(batch)
+					return
+				}
+			}
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) >= defaultBatchSize {
+				e.send(batch)
+				batch = []*Span{}
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = []*Span{}
+		}
+	}
+}
+
+func (e *OTLPExporter) send(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(e.request(batch))
+	if err != nil {
+		log.Printf("Unable to encode %d spans: %s\n", len(batch), err.Error())
+		return
+	}
+
+	res, err := e.Client.Post(e.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Unable to export %d spans to %s: %s\n", len(batch), e.Endpoint, err.Error())
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		log.Printf("Unable to export %d spans to %s: %s\n", len(batch), e.Endpoint, res.Status)
+	}
+}
+
+// The types below follow the JSON encoding of ExportTraceServiceRequest in the
+// OTLP specification, in which trace and span IDs are hex and 64-bit integers are strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code,omitempty"` // Code is 2 for an error
+}
+
+func (e *OTLPExporter) request(batch []*Span) otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, toOTLP(span))
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{attribute("service.name", e.ServiceName)},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "of-watchdog"},
+				Spans: spans,
+			}},
+		}},
+	}
+}
+
+func toOTLP(span *Span) otlpSpan {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+
+	s := otlpSpan{
+		TraceID:           hex.EncodeToString(span.Context.TraceID[:]),
+		SpanID:            hex.EncodeToString(span.Context.SpanID[:]),
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+	}
+
+	if span.Parent != (SpanID{}) {
+		s.ParentSpanID = hex.EncodeToString(span.Parent[:])
+	}
+
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.Attributes = append(s.Attributes, attribute(key, span.Attributes[key]))
+	}
+
+	if span.Error {
+		s.Status.Code = 2
+	}
+	return s
+}
+
+func attribute(key string, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+// String describes the exporter for the startup log
+func (e *OTLPExporter) String() string {
+	return fmt.Sprintf("OTLP %s (service.name=%s)", e.Endpoint, e.ServiceName)
+}
@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// makeCollector is a stub OTLP/HTTP collector which passes on each request it receives
+func makeCollector() (*httptest.Server, chan otlpRequest) {
+	requests := make(chan otlpRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		var req otlpRequest
+		json.Unmarshal(body, &req)
+		requests <- req
+	}))
+	return srv, requests
+}
+
+func TestOTLPExporter_ExportsRequestSpans(t *testing.T) {
+	collector, requests := makeCollector()
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL, "fn")
+	SetExporter(exporter)
+	defer SetExporter(nil)
+
+	limit := func(next http.Handler) http.Handler { return next }
+
+	handler := Middleware(Queue(limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := StartSpan(r.Context(), "exec", KindInternal)
+		span.Finish()
+		w.WriteHeader(http.StatusBadGateway)
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	exporter.Shutdown()
+
+	var spans []otlpSpan
+	select {
+	case req := <-requests:
+		if got := req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue; got != "fn" {
+			t.Errorf("want service.name fn, got: %q", got)
+		}
+		spans = req.ResourceSpans[0].ScopeSpans[0].Spans
+	case <-time.After(time.Second * 2):
+		t.Fatalf("no spans were exported")
+	}
+
+	byName := map[string]otlpSpan{}
+	for _, span := range spans {
+		if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("want span %s in the caller's trace, got: %s", span.Name, span.TraceID)
+		}
+		byName[span.Name] = span
+	}
+
+	server, ok := byName[http.MethodPost]
+	if !ok || len(byName) != 3 {
+		t.Fatalf("want server, queue and exec spans, got: %v", byName)
+	}
+
+	if server.ParentSpanID != "00f067aa0ba902b7" || server.Kind != KindServer || server.Status.Code != 2 {
+		t.Errorf("want failed server span as a child of the caller, got: %+v", server)
+	}
+
+	for _, name := range []string{"queue", "exec"} {
+		if byName[name].ParentSpanID != server.SpanID {
+			t.Errorf("want %s span to be a child of the server span, got parent: %s", name, byName[name].ParentSpanID)
+		}
+	}
+}
+
+func TestOTLPExporter_DropsSpansAfterShutdown(t *testing.T) {
+	collector, requests := makeCollector()
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL, "fn")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				exporter.Export(&Span{Name: "exec", Start: time.Now(), End: time.Now()})
+			}
+		}()
+	}
+
+	exporter.Shutdown()
+	exporter.Shutdown()
+	wg.Wait()
+
+	exporter.Export(&Span{Name: "late"})
+
+	select {
+	case req := <-requests:
+		for _, span := range req.ResourceSpans[0].ScopeSpans[0].Spans {
+			if span.Name == "late" {
+				t.Errorf("want spans ended after shutdown to be dropped")
+			}
+		}
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestMiddleware_DisabledWithoutExporter(t *testing.T) {
+	var span *Span
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span = FromContext(r.Context())
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if span != nil {
+		t.Errorf("want no span without an exporter")
+	}
+}
@@ -0,0 +1,168 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Kinds of span, numbered as in OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Exporter sends ended spans to a collector
+type Exporter interface {
+	Export(span *Span)
+}
+
+var (
+	exporterLock sync.RWMutex
+	exporter     Exporter
+)
+
+// SetExporter enables tracing, spans are only created once an exporter is set
+func SetExporter(e Exporter) {
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+
+	exporter = e
+}
+
+func currentExporter() Exporter {
+	exporterLock.RLock()
+	defer exporterLock.RUnlock()
+
+	return exporter
+}
+
+// Span is a timed operation within a trace. A nil *Span is valid and records nothing,
+// which is what StartSpan returns when tracing is disabled.
+type Span struct {
+	Name       string
+	Kind       int
+	Context    SpanContext
+	Parent     SpanID // Parent is zero for a root span
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Error      bool
+
+	mutex sync.Mutex
+	ended bool
+}
+
+type spanKey struct{}
+
+// FromContext returns the span of ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// StartSpan starts a child of the span in ctx, or a new trace when ctx has none
+func StartSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var parent SpanContext
+	if span := FromContext(ctx); span != nil {
+		parent = span.Context
+	}
+	return startSpan(ctx, name, kind, parent)
+}
+
+// startSpan starts a span of parent, which may be remote or zero for a new trace
+func startSpan(ctx context.Context, name string, kind int, parent SpanContext) (context.Context, *Span) {
+	if currentExporter() == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: map[string]string{},
+	}
+
+	if parent.IsValid() {
+		span.Context = SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(), Sampled: parent.Sampled}
+		span.Parent = parent.SpanID
+	} else {
+		span.Context = SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: true}
+	}
+
+	return withSpan(ctx, span), span
+}
+
+// withSpan returns a copy of ctx with span as its current span
+func withSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// WithSpan carries span into another context, i.e. the background context of an
+// async call, so that spans started from it stay in its trace. A nil span returns ctx.
+func WithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return withSpan(ctx, span)
+}
+
+// SetAttribute records a string attribute on the span
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Error = true
+}
+
+// Traceparent returns the header which makes a remote span a child of s, or "" for a nil span
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return s.Context.Traceparent()
+}
+
+// Finish ends the span and exports it if it is sampled. Only the first call has an effect.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mutex.Unlock()
+
+	if e := currentExporter(); e != nil && s.Context.Sampled {
+		e.Export(s)
+	}
+}
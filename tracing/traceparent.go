@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceparentHeader propagates the trace context, see https://www.w3.org/TR/trace-context/
+const TraceparentHeader = "Traceparent"
+
+// TraceparentEnv passes the trace context to a forked process
+const TraceparentEnv = "TRACEPARENT"
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// SpanContext is the part of a span which is propagated to other processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid returns false for the all-zero trace or span IDs, which are invalid
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != TraceID{} && c.SpanID != SpanID{}
+}
+
+// Traceparent formats the context as a version 00 traceparent header
+func (c SpanContext) Traceparent() string {
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(c.TraceID[:]), hex.EncodeToString(c.SpanID[:]), flags)
+}
+
+// ParseTraceparent parses a traceparent header, later versions are read as version 00
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent: %q", value)
+	}
+
+	var c SpanContext
+	if err := decodeHex(parts[1], c.TraceID[:]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace-id in traceparent: %q", value)
+	}
+	if err := decodeHex(parts[2], c.SpanID[:]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid parent-id in traceparent: %q", value)
+	}
+
+	var flags [1]byte
+	if err := decodeHex(parts[3], flags[:]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace-flags in traceparent: %q", value)
+	}
+	c.Sampled = flags[0]&1 == 1
+
+	if !c.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent: %q", value)
+	}
+	return c, nil
+}
+
+// decodeHex decodes lower-case hex of exactly len(dst) bytes
+func decodeHex(value string, dst []byte) error {
+	if len(value) != hex.EncodedLen(len(dst)) || strings.ToLower(value) != value {
+		return fmt.Errorf("invalid length or case")
+	}
+	_, err := hex.Decode(dst, []byte(value))
+	return err
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
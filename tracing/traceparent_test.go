@@ -0,0 +1,37 @@
+package tracing
+
+import "testing"
+
+func TestParseTraceparent(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	c, err := ParseTraceparent(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Sampled {
+		t.Errorf("want sampled flag to be set")
+	}
+	if got := c.Traceparent(); got != value {
+		t.Errorf("want %q, got: %q", value, got)
+	}
+}
+
+func TestParseTraceparent_Invalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+
+	for _, value := range invalid {
+		if _, err := ParseTraceparent(value); err == nil {
+			t.Errorf("want an error for %q", value)
+		}
+	}
+}